@@ -0,0 +1,34 @@
+// Package echocache adapts the cache middleware to Echo.
+package echocache
+
+import (
+	"net/http"
+
+	cache_handler "github.com/StevenCyb/cache_handler"
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/labstack/echo/v4"
+)
+
+// New creates an Echo middleware that serves responses from the cache
+func New(store store.Store, opts ...cache_handler.Option) echo.MiddlewareFunc {
+	return Wrap(cache_handler.Middleware(store, opts...))
+}
+
+// Wrap adapts a `func(http.Handler) http.Handler` middleware to Echo.
+// Errors of the next handler are handled inside the middleware,
+// so error responses pass the middleware like any other response.
+func Wrap(middleware func(http.Handler) http.Handler) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c.SetRequest(r)
+				c.SetResponse(echo.NewResponse(w, c.Echo()))
+				if err := next(c); err != nil {
+					c.Error(err)
+				}
+			})).ServeHTTP(c.Response(), c.Request())
+
+			return nil
+		}
+	}
+}
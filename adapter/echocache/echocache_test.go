@@ -0,0 +1,46 @@
+package echocache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	cache_handler "github.com/StevenCyb/cache_handler"
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/labstack/echo/v4"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	calls := 0
+	store := store.NewInMemoryStore(time.Minute)
+	defer store.Close()
+
+	e := echo.New()
+	e.Use(New(store, cache_handler.WithCacheableStatus(http.StatusOK)))
+	e.GET("/hello", func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, strconv.Itoa(calls))
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		calls++
+		return echo.NewHTTPError(http.StatusInternalServerError, strconv.Itoa(calls))
+	})
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest("GET", "/hello", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "1", rec.Body.String())
+	}
+
+	for i := 2; i <= 3; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest("GET", "/fail", nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), strconv.Itoa(i))
+	}
+}
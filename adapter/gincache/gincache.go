@@ -0,0 +1,124 @@
+// Package gincache adapts the cache middleware to Gin.
+package gincache
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	cache_handler "github.com/StevenCyb/cache_handler"
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/gin-gonic/gin"
+)
+
+// New creates a Gin middleware that serves responses from the cache
+func New(store store.Store, opts ...cache_handler.Option) gin.HandlerFunc {
+	return Wrap(cache_handler.Middleware(store, opts...))
+}
+
+// Wrap adapts a `func(http.Handler) http.Handler` middleware to Gin.
+// The handlers following in the chain are only called if the middleware
+// calls the next handler, otherwise the chain is aborted.
+func Wrap(middleware func(http.Handler) http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		calledNext := false
+		middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calledNext = true
+			writer := c.Writer
+			c.Request = r
+			rw := newResponseWriter(writer, w)
+			c.Writer = rw
+			c.Next()
+			rw.WriteHeaderNow()
+			c.Writer = writer
+		})).ServeHTTP(c.Writer, c.Request)
+
+		if !calledNext {
+			c.Abort()
+		}
+	}
+}
+
+// responseWriter passes the response written by Gin handlers
+// through the writer of the middleware. Like the writer of Gin
+// the status code is sent with the first write, so headers can
+// be set after the status.
+type responseWriter struct {
+	gin.ResponseWriter
+	writer http.ResponseWriter
+	status int
+	size   int
+}
+
+// newResponseWriter creates a responseWriter that writes through w
+func newResponseWriter(ginWriter gin.ResponseWriter, w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: ginWriter, writer: w, status: http.StatusOK, size: -1}
+}
+
+// Header returns the header of the middleware writer
+func (rw *responseWriter) Header() http.Header {
+	return rw.writer.Header()
+}
+
+// WriteHeader sets the status code sent with the first write
+func (rw *responseWriter) WriteHeader(status int) {
+	if status > 0 && !rw.Written() {
+		rw.status = status
+	}
+}
+
+// WriteHeaderNow sends the status code through the middleware, if not sent yet
+func (rw *responseWriter) WriteHeaderNow() {
+	if !rw.Written() {
+		rw.size = 0
+		rw.writer.WriteHeader(rw.status)
+	}
+}
+
+// Write writes data through the middleware
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	rw.WriteHeaderNow()
+	n, err := rw.writer.Write(data)
+	rw.size += n
+	return n, err
+}
+
+// WriteString writes the string through the middleware
+func (rw *responseWriter) WriteString(s string) (int, error) {
+	return rw.Write([]byte(s))
+}
+
+// Status returns the status code of the response
+func (rw *responseWriter) Status() int {
+	return rw.status
+}
+
+// Size returns the number of bytes written, -1 if the header was not written yet
+func (rw *responseWriter) Size() int {
+	return rw.size
+}
+
+// Written returns if the header was written
+func (rw *responseWriter) Written() bool {
+	return rw.size != -1
+}
+
+// Flush flushes through the middleware, so streamed responses are not cached
+func (rw *responseWriter) Flush() {
+	rw.WriteHeaderNow()
+	if flusher, ok := rw.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hijacks the connection through the middleware, so the response is not cached
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	if rw.size < 0 {
+		rw.size = 0
+	}
+	return hijacker.Hijack()
+}
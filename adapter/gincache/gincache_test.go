@@ -0,0 +1,148 @@
+package gincache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	cache_handler "github.com/StevenCyb/cache_handler"
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/gin-gonic/gin"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	store := store.NewInMemoryStore(time.Minute)
+	defer store.Close()
+
+	router := gin.New()
+	router.Use(New(store, cache_handler.WithCacheStatusHeader("", false), cache_handler.WithCacheableStatus(http.StatusOK)))
+	router.GET("/hello", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, strconv.Itoa(calls))
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusInternalServerError, strconv.Itoa(calls))
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/hello", nil))
+	assert.Equal(t, "1", rec.Body.String())
+	assert.Equal(t, "cache_handler; fwd=miss", rec.Header().Get("Cache-Status"))
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/hello", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Body.String())
+	assert.Equal(t, 1, calls)
+
+	for i := 2; i <= 3; i++ {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/fail", nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, strconv.Itoa(i), rec.Body.String())
+	}
+}
+
+func TestWrapAbortsChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	called := false
+
+	router := gin.New()
+	router.Use(Wrap(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+	}))
+	router.GET("/", func(c *gin.Context) { called = true })
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.False(t, called)
+}
+
+func TestNewStreamedResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	store := store.NewInMemoryStore(time.Minute)
+	defer store.Close()
+
+	router := gin.New()
+	router.Use(New(store))
+	router.GET("/events", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "event")
+		c.Writer.Flush()
+	})
+
+	for i := 1; i <= 2; i++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/events", nil))
+		assert.Equal(t, "event", rec.Body.String())
+		assert.True(t, rec.Flushed)
+		assert.Equal(t, i, calls)
+	}
+}
+
+func TestNewHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	store := store.NewInMemoryStore(time.Minute)
+	defer store.Close()
+
+	router := gin.New()
+	router.Use(New(store, cache_handler.WithCacheStatusHeader("", false)))
+	router.GET("/login", func(c *gin.Context) {
+		calls++
+		c.SetCookie("session", "secret", 60, "/", "", true, true)
+		c.Header("ETag", `"v1"`)
+		c.String(http.StatusOK, "0123456789")
+	})
+	router.GET("/video", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusOK)
+		c.Header("ETag", `"v1"`)
+		c.String(http.StatusOK, "0123456789")
+	})
+	router.GET("/empty", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusNoContent)
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Range", "bytes=0-1")
+		router.ServeHTTP(rec, r)
+		return rec
+	}
+
+	for i := 1; i <= 2; i++ {
+		rec := serve("/login")
+		assert.Contains(t, rec.Header().Get("Set-Cookie"), "session=secret")
+		assert.Equal(t, i, calls, "responses that set cookies are not cached")
+	}
+
+	rec := serve("/video")
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "01", rec.Body.String())
+	rec = serve("/video")
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, `"v1"`, rec.Header().Get("ETag"))
+	assert.Contains(t, rec.Header().Get("Cache-Status"), "hit")
+	assert.Equal(t, 3, calls)
+
+	for i := 0; i < 2; i++ {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/empty", nil))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+	assert.Equal(t, 4, calls)
+}
@@ -0,0 +1,277 @@
+package cache_handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxBodyKeySize is the size limit of request bodies used as key
+const defaultMaxBodyKeySize = 1 << 20
+
+var (
+	// ErrBodyTooLarge is returned by body key parts if the request body exceeds the size limit
+	ErrBodyTooLarge = errors.New("request body too large for the cache key")
+	// ErrGraphQLMutation is returned by UseGraphQLKey for operations that must not be cached
+	ErrGraphQLMutation = errors.New("graphql operation is not a query")
+)
+
+// UseBodyKey tells the cache to use the hash of the request body as part of the key,
+// e.g. for read-only POST endpoints. Bodies larger than MaxSize (default 1MB)
+// bypass the cache. The body is restored for the handler.
+type UseBodyKey struct{ MaxSize int64 }
+
+// KeyPart extract key from request and return the string
+func (opt UseBodyKey) KeyPart(r *http.Request) (string, error) {
+	body, err := peekBody(r, opt.MaxSize)
+	if err != nil {
+		return "", err
+	}
+	return hash(body), nil
+}
+
+func (opt UseBodyKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
+
+// UseJSONBodyKey tells the cache to use the hash of the canonical JSON request body
+// as part of the key, so whitespace and the order of fields don't matter.
+// Bodies that are no valid JSON or larger than MaxSize (default 1MB) bypass the cache.
+// The body is restored for the handler.
+type UseJSONBodyKey struct{ MaxSize int64 }
+
+// KeyPart extract key from request and return the string
+func (opt UseJSONBodyKey) KeyPart(r *http.Request) (string, error) {
+	body, err := peekBody(r, opt.MaxSize)
+	if err != nil {
+		return "", err
+	}
+
+	canonical, err := canonicalJSON(body)
+	if err != nil {
+		return "", err
+	}
+	return hash(canonical), nil
+}
+
+func (opt UseJSONBodyKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
+
+// UseGraphQLKey tells the cache to use the GraphQL request of the body as part of the key.
+// The query is normalized and the variables are canonicalized, so formatting doesn't matter.
+// Mutations, subscriptions, invalid requests and bodies larger than MaxSize (default 1MB)
+// bypass the cache. The body is restored for the handler.
+type UseGraphQLKey struct{ MaxSize int64 }
+
+// KeyPart extract key from request and return the string
+func (opt UseGraphQLKey) KeyPart(r *http.Request) (string, error) {
+	body, err := peekBody(r, opt.MaxSize)
+	if err != nil {
+		return "", err
+	}
+
+	request := struct {
+		Query         string          `json:"query"`
+		OperationName string          `json:"operationName"`
+		Variables     json.RawMessage `json:"variables"`
+	}{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", fmt.Errorf("invalid graphql request: %w", err)
+	}
+
+	tokens, err := graphqlTokens(request.Query)
+	if err != nil {
+		return "", err
+	}
+	operation, err := graphqlOperation(tokens, request.OperationName)
+	if err != nil {
+		return "", err
+	}
+	if operation != "query" {
+		return "", fmt.Errorf("%w: %s", ErrGraphQLMutation, operation)
+	}
+
+	variables := []byte("null")
+	if len(request.Variables) > 0 {
+		if variables, err = canonicalJSON(request.Variables); err != nil {
+			return "", err
+		}
+	}
+
+	h := sha256.New()
+	writeKeyComponent(h, strings.Join(tokens, " "))
+	writeKeyComponent(h, request.OperationName)
+	writeKeyComponent(h, string(variables))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (opt UseGraphQLKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
+
+// peekBody reads the request body up to maxSize and restores it for the handler
+func peekBody(r *http.Request, maxSize int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxBodyKeySize
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	r.Body = &restoredBody{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, maxSize)
+	}
+
+	return body, nil
+}
+
+// restoredBody reads the already read part of a body before the rest
+type restoredBody struct {
+	io.Reader
+	io.Closer
+}
+
+// hash returns the hex encoded sha256 hash of data
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON encodes the JSON document with sorted object keys and without whitespace
+func canonicalJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid json body: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid json body: unexpected data after the document")
+	}
+
+	return json.Marshal(value)
+}
+
+// graphqlTokens splits a GraphQL document into its tokens without whitespace,
+// commas and comments
+func graphqlTokens(document string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(document); {
+		c := document[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(document) && document[i] != '\n' && document[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(document[i:], `"""`):
+			end := strings.Index(document[i+3:], `"""`)
+			for end >= 0 && strings.HasSuffix(document[i+3:i+3+end], `\`) {
+				next := strings.Index(document[i+3+end+3:], `"""`)
+				if next < 0 {
+					end = -1
+					break
+				}
+				end += 3 + next
+			}
+			if end < 0 {
+				return nil, errors.New("invalid graphql query: unterminated block string")
+			}
+			tokens = append(tokens, document[i:i+3+end+3])
+			i += 3 + end + 3
+		case c == '"':
+			j := i + 1
+			for j < len(document) && document[j] != '"' {
+				if document[j] == '\n' {
+					break
+				}
+				if document[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(document) || document[j] != '"' {
+				return nil, errors.New("invalid graphql query: unterminated string")
+			}
+			tokens = append(tokens, document[i:j+1])
+			i = j + 1
+		case isNameChar(c) || c == '-':
+			j := i + 1
+			for j < len(document) && (isNameChar(document[j]) || document[j] == '.' || document[j] == '+' || document[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, document[i:j])
+			i = j
+		case strings.HasPrefix(document[i:], "..."):
+			tokens = append(tokens, "...")
+			i += 3
+		default:
+			tokens = append(tokens, document[i:i+1])
+			i++
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("invalid graphql query: empty document")
+	}
+	return tokens, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// graphqlOperation returns the type (`query`, `mutation` or `subscription`)
+// of the operation with given name, or of the only operation if name is empty
+func graphqlOperation(tokens []string, name string) (string, error) {
+	type operation struct{ kind, name string }
+	operations := []operation{}
+
+	depth := 0
+	for i, token := range tokens {
+		switch token {
+		case "{", "(", "[":
+			if depth == 0 && token == "{" && (i == 0 || tokens[i-1] == "}") {
+				operations = append(operations, operation{kind: "query"})
+			}
+			depth++
+		case "}", ")", "]":
+			depth--
+			if depth < 0 {
+				return "", errors.New("invalid graphql query: unbalanced brackets")
+			}
+		case "query", "mutation", "subscription":
+			if depth == 0 && (i == 0 || tokens[i-1] == "}") {
+				op := operation{kind: token}
+				if i+1 < len(tokens) && isNameChar(tokens[i+1][0]) {
+					op.name = tokens[i+1]
+				}
+				operations = append(operations, op)
+			}
+		}
+	}
+	if depth != 0 {
+		return "", errors.New("invalid graphql query: unbalanced brackets")
+	}
+
+	if name == "" {
+		if len(operations) != 1 {
+			return "", fmt.Errorf("invalid graphql query: %d operations without operationName", len(operations))
+		}
+		return operations[0].kind, nil
+	}
+	for _, op := range operations {
+		if op.name == name {
+			return op.kind, nil
+		}
+	}
+	return "", fmt.Errorf("invalid graphql query: operation %q not found", name)
+}
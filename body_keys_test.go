@@ -0,0 +1,146 @@
+package cache_handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bodyKeyOf(t *testing.T, part KeyPart, body string) (string, error) {
+	r := httptest.NewRequest("POST", "/search", strings.NewReader(body))
+	key, err := part.KeyPart(r)
+
+	restored, readErr := io.ReadAll(r.Body)
+	assert.NoError(t, readErr)
+	assert.Equal(t, body, string(restored), "body is restored")
+
+	return key, err
+}
+
+func TestUseBodyKey(t *testing.T) {
+	a, err := bodyKeyOf(t, UseBodyKey{}, `{"q":"go"}`)
+	assert.NoError(t, err)
+	b, err := bodyKeyOf(t, UseBodyKey{}, `{"q":"go"}`)
+	assert.NoError(t, err)
+	c, err := bodyKeyOf(t, UseBodyKey{}, `{"q": "go"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+
+	_, err = bodyKeyOf(t, UseBodyKey{MaxSize: 4}, "12345")
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	_, err = bodyKeyOf(t, UseBodyKey{MaxSize: 5}, "12345")
+	assert.NoError(t, err)
+
+	empty, err := UseBodyKey{}.KeyPart(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, hash(nil), empty)
+}
+
+func TestUseJSONBodyKey(t *testing.T) {
+	a, err := bodyKeyOf(t, UseJSONBodyKey{}, `{"q":"go","filter":{"lang":"en","year":2021}}`)
+	assert.NoError(t, err)
+	b, err := bodyKeyOf(t, UseJSONBodyKey{}, "{\n  \"filter\": {\"year\": 2021, \"lang\": \"en\"},\n  \"q\": \"go\"\n}")
+	assert.NoError(t, err)
+	c, err := bodyKeyOf(t, UseJSONBodyKey{}, `{"q":"go","filter":{"lang":"en","year":2022}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+
+	big1, err := bodyKeyOf(t, UseJSONBodyKey{}, `{"id":12345678901234567890}`)
+	assert.NoError(t, err)
+	big2, err := bodyKeyOf(t, UseJSONBodyKey{}, `{"id":12345678901234567891}`)
+	assert.NoError(t, err)
+	assert.NotEqual(t, big1, big2, "numbers keep their precision")
+
+	_, err = bodyKeyOf(t, UseJSONBodyKey{}, `{"q":`)
+	assert.ErrorContains(t, err, "invalid json body")
+	_, err = bodyKeyOf(t, UseJSONBodyKey{}, `{"q":"go"} {}`)
+	assert.ErrorContains(t, err, "unexpected data after the document")
+	_, err = bodyKeyOf(t, UseJSONBodyKey{MaxSize: 8}, `{"q":"golang"}`)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestUseGraphQLKey(t *testing.T) {
+	a, err := bodyKeyOf(t, UseGraphQLKey{}, `{"query":"query Users($first: Int) { users(first: $first) { id name } }","variables":{"first":10,"after":null}}`)
+	assert.NoError(t, err)
+	b, err := bodyKeyOf(t, UseGraphQLKey{}, `{"variables":{"after":null,"first":10},"query":"query Users($first: Int) {\n  # all users\n  users(first: $first) {\n    id,\n    name\n  }\n}"}`)
+	assert.NoError(t, err)
+	c, err := bodyKeyOf(t, UseGraphQLKey{}, `{"query":"query Users($first: Int) { users(first: $first) { id name } }","variables":{"first":20}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"{ users { id } }"}`)
+	assert.NoError(t, err)
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"{ users { id } } fragment F on User { name }"}`)
+	assert.NoError(t, err)
+
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"mutation { deleteUser(id: 1) { id } }"}`)
+	assert.ErrorIs(t, err, ErrGraphQLMutation)
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"subscription OnUser { user { id } }"}`)
+	assert.ErrorIs(t, err, ErrGraphQLMutation)
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"query A { a } mutation B { b }","operationName":"B"}`)
+	assert.ErrorIs(t, err, ErrGraphQLMutation)
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"query A { a } mutation B { b }","operationName":"A"}`)
+	assert.NoError(t, err)
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"query A { a } mutation B { b }"}`)
+	assert.ErrorContains(t, err, "2 operations without operationName")
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"query A { a }","operationName":"B"}`)
+	assert.ErrorContains(t, err, `operation "B" not found`)
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"{ users(name: \"mutation {\") { id } }"}`)
+	assert.NoError(t, err)
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":"{ users { id }"}`)
+	assert.ErrorContains(t, err, "unbalanced brackets")
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `{"query":""}`)
+	assert.ErrorContains(t, err, "empty document")
+	_, err = bodyKeyOf(t, UseGraphQLKey{}, `not json`)
+	assert.ErrorContains(t, err, "invalid graphql request")
+}
+
+func TestGraphQLTokens(t *testing.T) {
+	tokens, err := graphqlTokens("query Q($a: [Int!] = [1, -2.5e+3]) {\n  f(s: \"a \\\" b\", b: \"\"\"x \\\"\"\" y\"\"\") @skip(if: false) { ...F }\n}")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"query", "Q", "(", "$", "a", ":", "[", "Int", "!", "]", "=", "[", "1", "-2.5e+3", "]", ")", "{",
+		"f", "(", "s", ":", `"a \" b"`, "b", ":", `"""x \""" y"""`, ")", "@", "skip", "(", "if", ":", "false", ")",
+		"{", "...", "F", "}", "}",
+	}, tokens)
+
+	_, err = graphqlTokens(`{ f(s: "open) }`)
+	assert.ErrorContains(t, err, "unterminated string")
+	_, err = graphqlTokens(`{ f(s: """open) }`)
+	assert.ErrorContains(t, err, "unterminated block string")
+}
+
+func TestMiddlewareGraphQL(t *testing.T) {
+	calls := 0
+	s := store.NewInMemoryStore(time.Minute)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(strconv.Itoa(calls) + ":" + string(body)))
+	}, s, WithCacheableMethods("POST"), UseGraphQLKey{})
+
+	post := func(body string) string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(body)))
+		return w.Body.String()
+	}
+
+	query := `{"query":"{ users { id } }"}`
+	mutation := `{"query":"mutation { deleteUser(id: 1) { id } }"}`
+	assert.Equal(t, "1:"+query, post(query))
+	assert.Equal(t, "1:"+query, post(query))
+	assert.Equal(t, "2:"+mutation, post(mutation))
+	assert.Equal(t, "3:"+mutation, post(mutation))
+}
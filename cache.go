@@ -0,0 +1,117 @@
+package cache_handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/StevenCyb/cache_handler/store"
+)
+
+// Cache is a middleware whose store and options can be replaced at runtime.
+// Requests in flight finish with the store and options they started with.
+type Cache struct {
+	state atomic.Pointer[cacheState]
+}
+
+// Provider supplies new stores and options to a Cache
+type Provider interface {
+	// Watch calls reload after each change until ctx is done.
+	// The channel returned by reload is closed when no request
+	// uses the previous store and options anymore.
+	Watch(ctx context.Context, reload func(store.Store, ...Option) <-chan struct{}) error
+}
+
+// NewCache creates a Cache for given store and options
+func NewCache(store store.Store, opts ...Option) *Cache {
+	c := &Cache{}
+	c.state.Store(newCacheState(newCacheManager(store, opts...)))
+
+	return c
+}
+
+// Reload atomically replaces the store and options of the cache.
+// The returned channel is closed when all requests using
+// the previous store and options are finished.
+func (c *Cache) Reload(store store.Store, opts ...Option) <-chan struct{} {
+	previous := c.state.Swap(newCacheState(newCacheManager(store, opts...)))
+	previous.retire()
+
+	return previous.drained
+}
+
+// Watch reloads the cache with the changes of the provider until ctx is done
+func (c *Cache) Watch(ctx context.Context, p Provider) error {
+	return p.Watch(ctx, c.Reload)
+}
+
+// Handler creates a handler func that serves responses of next from the cache
+func (c *Cache) Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.serve(next, w, r)
+	}
+}
+
+// Middleware serves responses of next from the cache.
+// It fits routers that chain `func(http.Handler) http.Handler` like chi or gorilla/mux.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serve(next, w, r)
+	})
+}
+
+// serve the request with the current state
+func (c *Cache) serve(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	for {
+		state := c.state.Load()
+		if state.acquire() {
+			defer state.release()
+			state.cm.route(r).serve(next, w, r)
+			return
+		}
+	}
+}
+
+// cacheState is a cache manager together with the requests using it
+type cacheState struct {
+	cm        *cacheManager
+	inFlight  atomic.Int64
+	retired   atomic.Bool
+	drained   chan struct{}
+	drainOnce sync.Once
+}
+
+func newCacheState(cm *cacheManager) *cacheState {
+	return &cacheState{cm: cm, drained: make(chan struct{})}
+}
+
+// acquire the state for a request, fails if the state is retired
+func (s *cacheState) acquire() bool {
+	s.inFlight.Add(1)
+	if s.retired.Load() {
+		s.release()
+		return false
+	}
+
+	return true
+}
+
+// release the state after a request
+func (s *cacheState) release() {
+	if s.inFlight.Add(-1) == 0 && s.retired.Load() {
+		s.drain()
+	}
+}
+
+// retire the state, it is drained once no request uses it
+func (s *cacheState) retire() {
+	s.retired.Store(true)
+	if s.inFlight.Load() == 0 {
+		s.drain()
+	}
+}
+
+func (s *cacheState) drain() {
+	s.drainOnce.Do(func() { close(s.drained) })
+}
@@ -3,66 +3,263 @@ package cache_handler
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/StevenCyb/cache_handler/clock"
+	"github.com/StevenCyb/cache_handler/metrics"
 	"github.com/StevenCyb/cache_handler/store"
 )
 
 // cacheManager to record the response body from the ResponseWriter
 type cacheManager struct {
-	Store             store.Store
-	IncludeKeyOptions []Options
-	BypassOptions     []Options
+	Store              store.Store
+	KeyParts           []KeyPart
+	BypassRules        []BypassRule
+	TTL                time.Duration
+	MaxBodySize        int
+	UncacheableTTL     time.Duration
+	CacheableStatus    map[int]time.Duration
+	CacheableMethod    map[string]bool
+	Encodings          []Encoding
+	CompressedVariants bool
+	AllowSetCookie     bool
+	AllowPrivate       bool
+	AllowCredentials   bool
+	Logger             *slog.Logger
+	Metrics            metrics.Sink
+	Clock              clock.Clock
+	CacheStatus        *cacheStatusHeader
+	AgeHeader          bool
+	FailurePolicy      StoreFailurePolicy
+	Disabled           bool
+	breakerSettings    store.CircuitBreakerSettings
+	baseStore          store.Store
+	ownStore           store.Store
+	routes             []*route
+}
+
+// defaultCacheableMethods are the methods whose responses are cacheable by default (RFC 9110)
+var defaultCacheableMethods = map[string]bool{http.MethodGet: true, http.MethodHead: true}
+
+// defaultCacheableStatus are the heuristically cacheable status codes (RFC 9110 section 15.1)
+// without 206, partial responses are not cached. A TTL of 0 uses the TTL of the cache.
+var defaultCacheableStatus = map[int]time.Duration{
+	http.StatusOK:                   0,
+	http.StatusNonAuthoritativeInfo: 0,
+	http.StatusNoContent:            0,
+	http.StatusMultipleChoices:      0,
+	http.StatusMovedPermanently:     0,
+	http.StatusPermanentRedirect:    0,
+	http.StatusNotFound:             0,
+	http.StatusMethodNotAllowed:     0,
+	http.StatusGone:                 0,
+	http.StatusRequestURITooLong:    0,
+	http.StatusNotImplemented:       0,
+}
+
+// newCacheManager creates a cacheManager for given store that uses
+// the path as key and given options
+func newCacheManager(s store.Store, opts ...Option) *cacheManager {
+	cm := &cacheManager{
+		KeyParts: []KeyPart{UsePathKey{}},
+	}
+	cm.useOptions(opts...)
+	if cm.ownStore != nil {
+		s = cm.ownStore
+	}
+	cm.useStore(s)
+	cm.useRoutes()
+
+	return cm
 }
 
 // useOptions let the manager use given options
-func (cm *cacheManager) useOptions(opts ...Options) {
-	if cm.IncludeKeyOptions == nil {
-		cm.IncludeKeyOptions = []Options{}
+func (cm *cacheManager) useOptions(opts ...Option) {
+	if cm.KeyParts == nil {
+		cm.KeyParts = []KeyPart{}
+	}
+	if cm.BypassRules == nil {
+		cm.BypassRules = []BypassRule{}
+	}
+	if cm.Logger == nil {
+		cm.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if cm.Metrics == nil {
+		cm.Metrics = metrics.Discard
+	}
+	if cm.Clock == nil {
+		cm.Clock = clock.Real
+	}
+	if cm.CacheableStatus == nil {
+		cm.CacheableStatus = defaultCacheableStatus
 	}
-	if cm.BypassOptions == nil {
-		cm.BypassOptions = []Options{}
+	if cm.CacheableMethod == nil {
+		cm.CacheableMethod = defaultCacheableMethods
 	}
 
 	for _, opt := range opts {
-		switch optT := opt.(type) {
-		case AllowBypassHeader:
-			cm.BypassOptions = append(cm.BypassOptions, opt)
-		case AllowBypassMethod:
-			optT.Key = strings.ToLower(optT.Key)
-			cm.BypassOptions = append(cm.BypassOptions, optT)
-		case UsePathKey:
-			cm.IncludeKeyOptions = append(cm.IncludeKeyOptions, opt)
-		case UseMethodKey:
-			cm.IncludeKeyOptions = append(cm.IncludeKeyOptions, opt)
-		case UseQueryParamsKey:
-			cm.IncludeKeyOptions = append(cm.IncludeKeyOptions, opt)
-		case UseHeaderKey:
-			cm.IncludeKeyOptions = append(cm.IncludeKeyOptions, opt)
-		}
+		opt.apply(cm)
 	}
 }
 
-// keyFromRequest generate key based on request and configured options
-func (cm cacheManager) keyFromRequest(r *http.Request) string {
-	keyParts := []string{}
-	for _, inc := range cm.IncludeKeyOptions {
-		keyParts = append(keyParts, inc.ExtractString(r))
+// useStore let the manager use given store,
+// must be called after the options are set
+func (cm *cacheManager) useStore(s store.Store) {
+	cm.baseStore = s
+	cm.Store = s
+	if cm.FailurePolicy == CircuitBreak {
+		settings := cm.breakerSettings
+		if settings == (store.CircuitBreakerSettings{}) {
+			settings = breakerSettings(0, 0)
+		}
+		cm.Store = store.NewCircuitBreaker(s, settings,
+			store.WithLogger(cm.Logger), store.WithMetrics(cm.Metrics), store.WithClock(cm.Clock))
 	}
+}
+
+// keyVersion prefixes all keys, it changes whenever the encoding of keys changes.
+// It is separated with `-`, so keys are valid file names on all platforms.
+const keyVersion = "v1"
 
+// keyFromRequest generate key based on request and configured key parts.
+// Each part is encoded with its type and value, both length-prefixed,
+// so values of different parts can't be mistaken for each other.
+func (cm cacheManager) keyFromRequest(r *http.Request) (string, error) {
 	h := sha256.New()
-	h.Write([]byte(strings.Join(keyParts, "/")))
-	return hex.EncodeToString(h.Sum(nil))
+	fmt.Fprintf(h, "%s;%d;", keyVersion, len(cm.KeyParts))
+	for _, part := range cm.KeyParts {
+		value, err := part.KeyPart(r)
+		if err != nil {
+			return "", err
+		}
+		writeKeyComponent(h, fmt.Sprintf("%T", part))
+		writeKeyComponent(h, value)
+	}
+
+	return keyVersion + "-" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeKeyComponent writes the length-prefixed component
+func writeKeyComponent(w io.Writer, component string) {
+	fmt.Fprintf(w, "%d:%s;", len(component), component)
 }
 
 // canBypass return if bypass allowed
 func (cm cacheManager) canBypass(r *http.Request) bool {
-	for _, bo := range cm.BypassOptions {
-		if bo.ExtractBool(r) {
+	for _, rule := range cm.BypassRules {
+		if rule.Bypass(r) {
 			return true
 		}
 	}
 
 	return false
 }
+
+// isCacheable returns if a response with given status and body size can be cached,
+// partial responses are never cached
+func (cm cacheManager) isCacheable(status, size int) bool {
+	if status == http.StatusPartialContent {
+		return false
+	}
+	if cm.MaxBodySize > 0 && size > cm.MaxBodySize {
+		return false
+	}
+	_, ok := cm.CacheableStatus[status]
+
+	return ok
+}
+
+// isCacheableMethod returns if responses to requests with given method can be cached
+func (cm cacheManager) isCacheableMethod(method string) bool {
+	return cm.CacheableMethod[strings.ToUpper(method)]
+}
+
+// lookup result of the store
+type lookup int
+
+const (
+	lookupHit lookup = iota
+	lookupMiss
+	lookupExpired
+	lookupFailed
+	lookupSkipped
+)
+
+// lookup data for given key from the store
+func (cm cacheManager) lookup(key string) ([]byte, lookup) {
+	data, err := cm.Store.Get(key)
+	switch {
+	case err == nil:
+		return data, lookupHit
+	case errors.Is(err, store.ErrExpired):
+		return nil, lookupExpired
+	case store.IsMiss(err):
+		return nil, lookupMiss
+	case errors.Is(err, store.ErrUnavailable):
+		cm.Logger.Debug("store unavailable", slog.String("key", key))
+		return nil, lookupSkipped
+	}
+
+	cm.Metrics.Count("cache.store_errors", 1)
+	cm.Logger.Error("failed to read from store",
+		slog.String("key", key), slog.Any("error", err))
+	return nil, lookupFailed
+}
+
+// saveWithTTL saves data for given key to the store for the ttl,
+// the default ttl of the store is used if ttl is not positive
+func (cm cacheManager) saveWithTTL(key string, data []byte, ttl time.Duration) {
+	err := cm.Store.SetWithTTL(key, data, ttl)
+	switch {
+	case err == nil:
+		cm.Metrics.Count("cache.stored", 1)
+	case errors.Is(err, store.ErrUnavailable):
+		cm.Logger.Debug("store unavailable", slog.String("key", key))
+	case errors.Is(err, store.ErrTooLarge):
+		cm.Logger.Warn("response too large for store",
+			slog.String("key", key), slog.Any("error", err))
+	default:
+		cm.Metrics.Count("cache.store_errors", 1)
+		cm.Logger.Error("failed to store response",
+			slog.String("key", key), slog.Any("error", err))
+	}
+}
+
+// newEntry creates an entry for given response created now
+func (cm cacheManager) newEntry(status int, header http.Header, body []byte) entry {
+	e := entry{
+		Created: cm.Clock.Now(),
+		Status:  status,
+		Header:  storedHeader(header),
+		Body:    body,
+	}
+	if ttl := cm.statusTTL(status); ttl > 0 {
+		e.Expires = e.Created.Add(ttl)
+	}
+
+	return e
+}
+
+// ttl returns how long responses are cached
+func (cm cacheManager) ttl() time.Duration {
+	if cm.TTL > 0 {
+		return cm.TTL
+	}
+
+	return cm.Store.Expiration()
+}
+
+// statusTTL returns how long responses with given status are cached
+func (cm cacheManager) statusTTL(status int) time.Duration {
+	if ttl := cm.CacheableStatus[status]; ttl > 0 {
+		return ttl
+	}
+
+	return cm.ttl()
+}
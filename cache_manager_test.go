@@ -3,14 +3,21 @@ package cache_handler
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/StevenCyb/cache_handler/clock"
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
+	"github.com/StevenCyb/cache_handler/store"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCacheManagerOptionUsage(t *testing.T) {
-	useKeyOptions := []Options{
+	useKeyOptions := []Option{
 		UseHeaderKey{Key: "h1"},
 		UseHeaderKey{Key: "h2"},
 		UseMethodKey{},
@@ -18,7 +25,7 @@ func TestCacheManagerOptionUsage(t *testing.T) {
 		UseQueryParamsKey{Key: "qp1"},
 		UseQueryParamsKey{Key: "qp2"},
 	}
-	allowBypassOptions := []Options{
+	allowBypassOptions := []Option{
 		AllowBypassHeader{Key: "Cache-Status", Value: "bypass"},
 		AllowBypassMethod{Key: "post"},
 		AllowBypassMethod{Key: "put"},
@@ -28,19 +35,36 @@ func TestCacheManagerOptionUsage(t *testing.T) {
 	cm.useOptions(allowBypassOptions...)
 	cm.useOptions(useKeyOptions...)
 
-	assert.Len(t, cm.IncludeKeyOptions, len(useKeyOptions))
+	assert.Len(t, cm.KeyParts, len(useKeyOptions))
 	for i, ko := range useKeyOptions {
-		assert.Equal(t, ko, cm.IncludeKeyOptions[i])
+		assert.Equal(t, ko, cm.KeyParts[i])
 	}
 
-	assert.Len(t, cm.BypassOptions, len(allowBypassOptions))
+	assert.Len(t, cm.BypassRules, len(allowBypassOptions))
 	for i, abo := range allowBypassOptions {
-		assert.Equal(t, abo, cm.BypassOptions[i])
+		assert.Equal(t, abo, cm.BypassRules[i])
 	}
 }
 
+func TestCacheManagerUseLoggerAndClock(t *testing.T) {
+	cm := cacheManager{}
+	cm.useOptions()
+	assert.NotNil(t, cm.Logger)
+	assert.Equal(t, clock.Real, cm.Clock)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cm.useOptions(WithLogger(logger))
+	assert.Same(t, logger, cm.Logger)
+
+	fake := clocktest.NewFake(time.Now())
+	cm.useOptions(WithClock(fake))
+	assert.Same(t, fake, cm.Clock)
+	assert.Empty(t, cm.KeyParts)
+	assert.Empty(t, cm.BypassRules)
+}
+
 func TestCacheManagerKeyFromRequest(t *testing.T) {
-	keyOptions := []Options{
+	keyOptions := []Option{
 		UseMethodKey{},
 		UsePathKey{},
 		UseHeaderKey{Key: "H1"},
@@ -58,13 +82,180 @@ func TestCacheManagerKeyFromRequest(t *testing.T) {
 	r.Header.Add("h2", "h2")
 
 	h := sha256.New()
-	h.Write([]byte("GET//sub/h1/h2/qp1/qp2"))
-	assert.Equal(t, hex.EncodeToString(h.Sum(nil)), cm.keyFromRequest(r))
+	h.Write([]byte("v1;6;" +
+		"26:cache_handler.UseMethodKey;3:GET;" +
+		"24:cache_handler.UsePathKey;4:/sub;" +
+		"26:cache_handler.UseHeaderKey;4:1:h1;" +
+		"26:cache_handler.UseHeaderKey;4:1:h2;" +
+		"31:cache_handler.UseQueryParamsKey;7:qp1=qp1;" +
+		"31:cache_handler.UseQueryParamsKey;7:qp2=qp2;"))
+	key, err := cm.keyFromRequest(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1-"+hex.EncodeToString(h.Sum(nil)), key)
+}
+
+// TestCacheManagerKeyCollisions covers requests that produced the same key
+// when the parts were joined with `/`
+func TestCacheManagerKeyCollisions(t *testing.T) {
+	type keyed struct {
+		parts  []Option
+		url    string
+		header http.Header
+	}
+	auth := []Option{UseHeaderKey{Key: "Authorization"}}
+	tests := []struct {
+		name string
+		a, b keyed
+	}{
+		{
+			"path absorbs header",
+			keyed{auth, "/a/b", http.Header{}},
+			keyed{auth, "/a", http.Header{"Authorization": {"b"}}},
+		},
+		{
+			"header absorbs path",
+			keyed{auth, "/a", http.Header{"Authorization": {"b/c"}}},
+			keyed{auth, "/a/b", http.Header{"Authorization": {"c"}}},
+		},
+		{
+			"separator in header value",
+			keyed{[]Option{UseHeaderKey{Key: "A"}, UseHeaderKey{Key: "B"}}, "/", http.Header{"A": {"x/y"}}},
+			keyed{[]Option{UseHeaderKey{Key: "A"}, UseHeaderKey{Key: "B"}}, "/", http.Header{"A": {"x"}, "B": {"y"}}},
+		},
+		{
+			"multiple header values",
+			keyed{auth, "/", http.Header{"Authorization": {"a", "b"}}},
+			keyed{auth, "/", http.Header{"Authorization": {"a/b"}}},
+		},
+		{
+			"escaped header value",
+			keyed{auth, "/", http.Header{"Authorization": {"a", "b"}}},
+			keyed{auth, "/", http.Header{"Authorization": {"a,b"}}},
+		},
+		{
+			"missing and empty header",
+			keyed{auth, "/", http.Header{}},
+			keyed{auth, "/", http.Header{"Authorization": {""}}},
+		},
+		{
+			"missing and empty cookie",
+			keyed{[]Option{UseCookieKey{Key: "session"}}, "/", http.Header{}},
+			keyed{[]Option{UseCookieKey{Key: "session"}}, "/", http.Header{"Cookie": {"session="}}},
+		},
+		{
+			"query absorbs path",
+			keyed{[]Option{UseQueryParamsKey{Key: "q"}}, "/a/q=b", http.Header{}},
+			keyed{[]Option{UseQueryParamsKey{Key: "q"}}, "/a?q=b", http.Header{}},
+		},
+		{
+			"same values of different parts",
+			keyed{[]Option{UseHeaderKey{Key: "X"}}, "/", http.Header{"X": {"GET"}}},
+			keyed{[]Option{UseMethodKey{}}, "/", http.Header{}},
+		},
+		{
+			"empty part",
+			keyed{[]Option{UseHeaderKey{Key: "X"}}, "/a", http.Header{}},
+			keyed{nil, "/a", http.Header{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyOf := func(k keyed) string {
+				cm := newCacheManager(nil, k.parts...)
+				r, err := http.NewRequest("GET", k.url, nil)
+				assert.NoError(t, err)
+				r.Header = k.header
+				key, err := cm.keyFromRequest(r)
+				assert.NoError(t, err)
+				return key
+			}
+
+			assert.NotEqual(t, keyOf(test.a), keyOf(test.b))
+		})
+	}
+}
+
+type failingKeyPart struct{}
+
+func (failingKeyPart) KeyPart(r *http.Request) (string, error) {
+	return "", errors.New("no tenant")
+}
+
+func TestCacheManagerKeyFromRequestError(t *testing.T) {
+	cm := cacheManager{}
+	cm.useOptions(UsePathKey{}, WithKeyPart(failingKeyPart{}))
+
+	r, err := http.NewRequest("GET", "https://not-exists.com/sub", nil)
+	assert.NoError(t, err)
+	_, err = cm.keyFromRequest(r)
+	assert.EqualError(t, err, "no tenant")
+}
+
+func TestCacheManagerIsCacheable(t *testing.T) {
+	cm := cacheManager{}
+	cm.useOptions()
+	assert.True(t, cm.isCacheable(http.StatusOK, 1<<20))
+	assert.True(t, cm.isCacheable(http.StatusNotFound, 0))
+	assert.False(t, cm.isCacheable(http.StatusPartialContent, 0))
+	assert.False(t, cm.isCacheable(http.StatusUnauthorized, 0))
+	assert.False(t, cm.isCacheable(http.StatusInternalServerError, 0))
+
+	cm.useOptions(WithMaxBodySize(4), WithCacheableStatus(http.StatusOK, http.StatusNotFound))
+	assert.True(t, cm.isCacheable(http.StatusOK, 4))
+	assert.True(t, cm.isCacheable(http.StatusNotFound, 0))
+	assert.False(t, cm.isCacheable(http.StatusOK, 5))
+	assert.False(t, cm.isCacheable(http.StatusInternalServerError, 0))
+
+	cm.useOptions(WithStatusTTL(http.StatusInternalServerError, time.Second), WithoutCacheableStatus(http.StatusNotFound))
+	assert.True(t, cm.isCacheable(http.StatusInternalServerError, 0))
+	assert.False(t, cm.isCacheable(http.StatusNotFound, 0))
+
+	cm.useOptions(WithStatusTTL(http.StatusPartialContent, time.Second))
+	assert.False(t, cm.isCacheable(http.StatusPartialContent, 0))
+}
+
+func TestCacheManagerIsCacheableMethod(t *testing.T) {
+	cm := cacheManager{}
+	cm.useOptions()
+	assert.True(t, cm.isCacheableMethod("GET"))
+	assert.True(t, cm.isCacheableMethod("HEAD"))
+	assert.False(t, cm.isCacheableMethod("POST"))
+
+	cm.useOptions(WithCacheableMethods("get", "post"))
+	assert.True(t, cm.isCacheableMethod("GET"))
+	assert.True(t, cm.isCacheableMethod("post"))
+	assert.False(t, cm.isCacheableMethod("HEAD"))
+}
+
+func TestCacheManagerStatusTTL(t *testing.T) {
+	cm := newCacheManager(store.NewInMemoryStore(time.Minute), WithStatusTTL(http.StatusNotFound, 30*time.Second))
+	defer cm.Store.Close()
+	assert.Equal(t, time.Minute, cm.statusTTL(http.StatusOK))
+	assert.Equal(t, 30*time.Second, cm.statusTTL(http.StatusNotFound))
+	assert.Equal(t, time.Duration(0), defaultCacheableStatus[http.StatusNotFound], "defaults are not modified")
+}
+
+func TestCacheManagerNewEntry(t *testing.T) {
+	fake := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	cm := newCacheManager(store.NewInMemoryStore(time.Minute), WithClock(fake))
+	defer cm.Store.Close()
+
+	e := cm.newEntry(http.StatusNotFound, http.Header{"Content-Type": {"text/plain"}, "Set-Cookie": {"a=b"}}, []byte("content"))
+	assert.Equal(t, fake.Now(), e.Created)
+	assert.Equal(t, fake.Now().Add(time.Minute), e.Expires)
+	assert.Equal(t, http.StatusNotFound, e.Status)
+	assert.Equal(t, http.Header{"Content-Type": {"text/plain"}}, e.Header)
+	assert.Equal(t, []byte("content"), e.Body)
+
+	cm.useOptions(WithTTL(time.Hour))
+	e = cm.newEntry(http.StatusOK, http.Header{}, nil)
+	assert.Equal(t, fake.Now().Add(time.Hour), e.Expires)
 }
 
 func TestCacheManagerAllowBypassHeader(t *testing.T) {
 	cm := cacheManager{
-		BypassOptions: []Options{AllowBypassHeader{Key: "Cache-Status", Value: "bypass"}},
+		BypassRules: []BypassRule{AllowBypassHeader{Key: "Cache-Status", Value: "bypass"}},
 	}
 
 	r, err := http.NewRequest("GET", "https://not-exists.com/sub", nil)
@@ -84,7 +275,7 @@ func TestCacheManagerAllowBypassHeader(t *testing.T) {
 
 func TestCacheManagerAllowBypassMethod(t *testing.T) {
 	cm := cacheManager{
-		BypassOptions: []Options{AllowBypassMethod{Key: "post"}},
+		BypassRules: []BypassRule{AllowBypassMethod{Key: "post"}},
 	}
 
 	r, err := http.NewRequest("get", "https://not-exists.com/sub", nil)
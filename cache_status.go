@@ -0,0 +1,58 @@
+package cache_handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache-Status values as defined in RFC 9211
+const (
+	cacheStatusHit    = "hit"
+	cacheStatusMiss   = "fwd=miss"
+	cacheStatusBypass = "fwd=bypass"
+	cacheStatusStale  = "fwd=stale"
+	// cacheStatusUnavailable is used if the store failed or is not used
+	// after consecutive failures
+	cacheStatusUnavailable = "fwd=bypass; detail=store-unavailable"
+	// cacheStatusUncacheable is used if the response recently exceeded the maximum body size
+	cacheStatusUncacheable = "fwd=bypass; detail=uncacheable"
+)
+
+// defaultCacheName is used as cache identifier in the Cache-Status header
+const defaultCacheName = "cache_handler"
+
+// cacheStatusHeader configures the Cache-Status header
+type cacheStatusHeader struct {
+	name       string
+	includeKey bool
+}
+
+// setCacheStatus sets the Cache-Status header if enabled.
+// ttl is only reported if known.
+func (cm cacheManager) setCacheStatus(w http.ResponseWriter, status, key string, ttl time.Duration, ttlKnown bool) {
+	if cm.CacheStatus == nil {
+		return
+	}
+
+	params := []string{cm.CacheStatus.name, status}
+	if ttlKnown {
+		params = append(params, "ttl="+strconv.FormatInt(int64(ttl/time.Second), 10))
+	}
+	if cm.CacheStatus.includeKey && key != "" {
+		params = append(params, fmt.Sprintf("key=%q", key))
+	}
+
+	w.Header().Add("Cache-Status", strings.Join(params, "; "))
+}
+
+// setAge sets the Age header if enabled
+func (cm cacheManager) setAge(w http.ResponseWriter, age time.Duration) {
+	if !cm.AgeHeader {
+		return
+	}
+
+	w.Header().Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+}
@@ -0,0 +1,40 @@
+package cache_handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheManagerSetCacheStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+	cm := cacheManager{}
+	cm.setCacheStatus(w, cacheStatusHit, "abc", time.Minute, true)
+	assert.Empty(t, w.Header().Get("Cache-Status"))
+
+	WithCacheStatusHeader("", false).apply(&cm)
+	cm.setCacheStatus(w, cacheStatusHit, "abc", time.Minute, true)
+	assert.Equal(t, "cache_handler; hit; ttl=60", w.Header().Get("Cache-Status"))
+
+	w = httptest.NewRecorder()
+	WithCacheStatusHeader("edge", true).apply(&cm)
+	cm.setCacheStatus(w, cacheStatusMiss, "abc", 0, false)
+	assert.Equal(t, `edge; fwd=miss; key="abc"`, w.Header().Get("Cache-Status"))
+
+	w = httptest.NewRecorder()
+	cm.setCacheStatus(w, cacheStatusBypass, "", 0, false)
+	assert.Equal(t, `edge; fwd=bypass`, w.Header().Get("Cache-Status"))
+}
+
+func TestCacheManagerSetAge(t *testing.T) {
+	w := httptest.NewRecorder()
+	cm := cacheManager{}
+	cm.setAge(w, time.Minute)
+	assert.Empty(t, w.Header().Get("Age"))
+
+	WithAgeHeader().apply(&cm)
+	cm.setAge(w, 90*time.Second+500*time.Millisecond)
+	assert.Equal(t, "90", w.Header().Get("Age"))
+}
@@ -0,0 +1,98 @@
+package cache_handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, handler http.Handler, path string) string {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Body.String()
+}
+
+func TestCacheReload(t *testing.T) {
+	s := store.NewInMemoryStore(time.Minute)
+	defer s.Close()
+	calls := 0
+	cache := NewCache(s)
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+
+	assert.Equal(t, "page=1", get(t, handler, "/users?page=1"))
+	assert.Equal(t, "page=1", get(t, handler, "/users?page=2"))
+	assert.Equal(t, 1, calls)
+
+	drained := cache.Reload(s, UseQueryParamsKey{Key: "page"})
+	<-drained
+	assert.Equal(t, "page=2", get(t, handler, "/users?page=2"))
+	assert.Equal(t, "page=2", get(t, handler, "/users?page=2"))
+	assert.Equal(t, 2, calls)
+
+	<-cache.Reload(s)
+	assert.Equal(t, "page=1", get(t, handler, "/users?page=3"))
+	assert.Equal(t, 2, calls)
+}
+
+func TestCacheReloadWaitsForRequestsInFlight(t *testing.T) {
+	s := store.NewInMemoryStore(time.Minute)
+	defer s.Close()
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	cache := NewCache(s)
+	handler := cache.Handler(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-finish
+		}
+		w.Write([]byte(r.URL.Path))
+	})
+
+	done := make(chan string)
+	go func() { done <- get(t, handler, "/slow") }()
+	<-started
+
+	drained := cache.Reload(s, WithoutCache())
+	assert.Equal(t, "/fast", get(t, handler, "/fast"))
+	select {
+	case <-drained:
+		t.Fatal("drained while a request is in flight")
+	default:
+	}
+
+	close(finish)
+	assert.Equal(t, "/slow", <-done)
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("not drained after the request finished")
+	}
+}
+
+type testProvider struct {
+	store store.Store
+	opts  []Option
+}
+
+func (p testProvider) Watch(ctx context.Context, reload func(store.Store, ...Option) <-chan struct{}) error {
+	<-reload(p.store, p.opts...)
+	return nil
+}
+
+func TestCacheWatch(t *testing.T) {
+	s := store.NewInMemoryStore(time.Minute)
+	defer s.Close()
+	cache := NewCache(s)
+
+	assert.NoError(t, cache.Watch(context.Background(), testProvider{store: s, opts: []Option{WithoutCache()}}))
+	assert.True(t, cache.state.Load().cm.Disabled)
+}
@@ -0,0 +1,24 @@
+package clock
+
+import "time"
+
+// Clock tells the current time and waits for durations to elapse
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// After waits for the duration to elapse and then sends the current time
+	// on the returned channel
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock uses the time of the system
+type realClock struct{}
+
+// Now returns the current time of the system
+func (realClock) Now() time.Time { return time.Now() }
+
+// After waits for the duration to elapse on the system clock
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Real is the Clock of the system
+var Real Clock = realClock{}
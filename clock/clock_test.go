@@ -0,0 +1,21 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReal(t *testing.T) {
+	before := time.Now()
+	now := Real.Now()
+	assert.False(t, now.Before(before))
+	assert.False(t, now.After(time.Now()))
+}
+
+func TestRealAfter(t *testing.T) {
+	before := time.Now()
+	<-Real.After(time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(before), time.Millisecond)
+}
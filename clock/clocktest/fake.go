@@ -0,0 +1,99 @@
+package clocktest
+
+import (
+	"sync"
+	"time"
+)
+
+// waiter is a pending call of After
+type waiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// Fake is a clock that only moves if advanced manually.
+// Channels returned by After fire when the clock is advanced past their deadline.
+type Fake struct {
+	mutex     *sync.Mutex
+	cond      *sync.Cond
+	now       time.Time
+	waiters   []waiter
+	onAdvance []func(time.Duration)
+}
+
+// NewFake create a new Fake clock starting at given time
+func NewFake(now time.Time) *Fake {
+	mutex := &sync.Mutex{}
+	return &Fake{
+		mutex: mutex,
+		cond:  sync.NewCond(mutex),
+		now:   now,
+	}
+}
+
+// Now returns the current time of the clock
+func (fake *Fake) Now() time.Time {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	return fake.now
+}
+
+// After returns a channel that receives the time once the clock
+// is advanced by at least given duration
+func (fake *Fake) After(d time.Duration) <-chan time.Time {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- fake.now
+		return c
+	}
+
+	fake.waiters = append(fake.waiters, waiter{deadline: fake.now.Add(d), c: c})
+	fake.cond.Broadcast()
+	return c
+}
+
+// Advance moves the clock forward by given duration
+// and fires all waiters whose deadline has passed
+func (fake *Fake) Advance(d time.Duration) {
+	fake.mutex.Lock()
+	fake.now = fake.now.Add(d)
+	pending := []waiter{}
+	for _, w := range fake.waiters {
+		if w.deadline.After(fake.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.c <- fake.now
+	}
+	fake.waiters = pending
+	onAdvance := fake.onAdvance
+	fake.mutex.Unlock()
+
+	for _, fn := range onAdvance {
+		fn(d)
+	}
+}
+
+// BlockUntil blocks until at least n calls of After are waiting,
+// e.g. to know that a background loop finished its iteration.
+func (fake *Fake) BlockUntil(n int) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	for len(fake.waiters) < n {
+		fake.cond.Wait()
+	}
+}
+
+// OnAdvance registers fn to be called with the duration the clock is advanced by,
+// e.g. to move the time of an external service like miniredis.
+func (fake *Fake) OnAdvance(fn func(time.Duration)) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.onAdvance = append(fake.onAdvance, fn)
+}
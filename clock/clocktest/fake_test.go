@@ -0,0 +1,50 @@
+package clocktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	var _ clock.Clock = fake
+	assert.Equal(t, start, fake.Now())
+
+	advanced := time.Duration(0)
+	fake.OnAdvance(func(d time.Duration) { advanced += d })
+	fake.Advance(time.Minute)
+	fake.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Minute+time.Second), fake.Now())
+	assert.Equal(t, time.Minute+time.Second, advanced)
+}
+
+func TestFakeAfter(t *testing.T) {
+	start := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+
+	assert.Equal(t, start, <-fake.After(0))
+
+	c := fake.After(time.Minute)
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	select {
+	case <-c:
+		t.Fatal("fired before deadline")
+	default:
+	}
+
+	fake.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute+time.Second), <-c)
+
+	done := make(chan struct{})
+	go func() {
+		fake.BlockUntil(1)
+		close(done)
+	}()
+	fake.After(time.Second)
+	<-done
+}
@@ -0,0 +1,337 @@
+package cache_handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoding is a content coding the middleware compresses responses with
+type Encoding string
+
+const (
+	// Brotli compresses with brotli (`br`)
+	Brotli Encoding = "br"
+	// Zstd compresses with Zstandard (`zstd`)
+	Zstd Encoding = "zstd"
+	// Gzip compresses with gzip (`gzip`)
+	Gzip Encoding = "gzip"
+)
+
+// defaultEncodings are used by WithCompression without encodings, in order of preference
+var defaultEncodings = []Encoding{Brotli, Zstd, Gzip}
+
+// WithCompression lets the middleware cache one uncompressed response and compress it
+// on the fly with the preferred encoding of the `Accept-Encoding` request header.
+// The handler is called without `Accept-Encoding`, so it doesn't compress responses itself,
+// and responses get `Vary: Accept-Encoding`. If the client accepts several encodings with
+// the same quality, the order of encodings decides, by default brotli, zstd and gzip.
+// It panics if an encoding is not one of Brotli, Zstd and Gzip.
+func WithCompression(encodings ...Encoding) Option {
+	for _, encoding := range encodings {
+		if !slices.Contains(defaultEncodings, encoding) {
+			panic(fmt.Sprintf("cache_handler: unknown encoding %q, expected one of br, zstd, gzip", encoding))
+		}
+	}
+
+	return optionFunc(func(cm *cacheManager) {
+		if len(encodings) == 0 {
+			encodings = defaultEncodings
+		}
+		cm.Encodings = slices.Clone(encodings)
+	})
+}
+
+// WithCompressedVariants stores the compressed variants of responses next to the
+// uncompressed response, so responses are only compressed once per encoding.
+// It needs WithCompression.
+func WithCompressedVariants() Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.CompressedVariants = true
+	})
+}
+
+// encoder is a compressing writer
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// newEncoder creates an encoder for the encoding that writes to w,
+// nil if the encoding is unknown
+func newEncoder(encoding Encoding, w io.Writer) encoder {
+	switch encoding {
+	case Brotli:
+		return brotli.NewWriter(w)
+	case Zstd:
+		// the default options are valid, so there is no error
+		enc, _ := zstd.NewWriter(w)
+		return enc
+	case Gzip:
+		return gzip.NewWriter(w)
+	}
+
+	return nil
+}
+
+// compress returns data compressed with the encoding
+func compress(encoding Encoding, data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := newEncoder(encoding, buf)
+	if enc == nil {
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+	if _, err := enc.Write(data); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// negotiateEncoding returns the encoding of encodings the `Accept-Encoding` header prefers,
+// or an empty encoding if the response should not be compressed
+func negotiateEncoding(acceptEncoding string, encodings []Encoding) Encoding {
+	if acceptEncoding == "" || len(encodings) == 0 {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if name != "" {
+			qualities[name] = quality
+		}
+	}
+
+	best, bestQuality := Encoding(""), 0.0
+	for _, encoding := range encodings {
+		quality, ok := qualities[string(encoding)]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	if identity, ok := qualities["identity"]; ok && identity > bestQuality {
+		return ""
+	}
+
+	return best
+}
+
+// isCompressible returns if a response with given status and header should be compressed
+func isCompressible(status int, header http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	switch {
+	case contentType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(contentType, "image/"), strings.HasPrefix(contentType, "video/"),
+		strings.HasPrefix(contentType, "audio/"), strings.HasPrefix(contentType, "font/woff"):
+		return false
+	}
+	switch contentType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+		"application/x-brotli", "application/pdf":
+		return false
+	}
+
+	return true
+}
+
+// addVary adds the header name to the `Vary` header if it isn't listed yet
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+// setEncodingHeaders marks the response as compressed with the encoding.
+// Strong ETags are weakened, they identify the uncompressed response.
+func setEncodingHeaders(header http.Header, encoding Encoding) {
+	header.Set("Content-Encoding", string(encoding))
+	header.Del("Content-Length")
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// compressWriter compresses the response written by the handler with the encoding,
+// unless the encoding is empty or the response is not compressible
+type compressWriter struct {
+	http.ResponseWriter
+	encoding Encoding
+	encoder  encoder
+	etag     string
+	decided  bool
+}
+
+// newCompressWriter creates a writer that compresses with the encoding and implements
+// exactly the optional interfaces http.Flusher, http.Hijacker and http.Pusher of w,
+// flushing and hijacking also if a writer w unwraps to supports them
+func newCompressWriter(w http.ResponseWriter, encoding Encoding) (*compressWriter, http.ResponseWriter) {
+	cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+
+	var (
+		f http.Flusher
+		h http.Hijacker
+		p http.Pusher
+	)
+	if canFlush(w) {
+		f = cw
+	}
+	if canHijack(w) {
+		h = controllerHijacker{w}
+	}
+	if pusher, ok := w.(http.Pusher); ok {
+		p = pusher
+	}
+
+	return cw, withOptionalInterfaces(cw, f, h, nil, p)
+}
+
+// decide if the response is compressed, once the final status is known
+func (cw *compressWriter) decide(status int) {
+	if cw.decided || status < http.StatusOK {
+		return
+	}
+	cw.decided = true
+
+	header := cw.Header()
+	addVary(header, "Accept-Encoding")
+	if cw.encoding == "" || !isCompressible(status, header) {
+		return
+	}
+	if cw.encoder = newEncoder(cw.encoding, cw.ResponseWriter); cw.encoder == nil {
+		return
+	}
+	cw.etag = header.Get("ETag")
+	setEncodingHeaders(header, cw.encoding)
+}
+
+// WriteHeader decides if the response is compressed and sends the status code
+func (cw *compressWriter) WriteHeader(status int) {
+	cw.decide(status)
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Write compresses the data if the response is compressed and sends it.
+// Like net/http the content type is detected if not set, but from the uncompressed data.
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.decided && cw.encoding != "" && cw.Header().Get("Content-Type") == "" {
+		cw.Header().Set("Content-Type", http.DetectContentType(data))
+	}
+	cw.decide(http.StatusOK)
+	if cw.encoder != nil {
+		return cw.encoder.Write(data)
+	}
+
+	return cw.ResponseWriter.Write(data)
+}
+
+// Flush sends the data compressed so far
+func (cw *compressWriter) Flush() {
+	cw.decide(http.StatusOK)
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close completes the compressed response
+func (cw *compressWriter) Close() error {
+	if cw.encoder == nil {
+		return nil
+	}
+
+	return cw.encoder.Close()
+}
+
+// uncompressedHeader returns the header of the response as written by the handler
+func (cw *compressWriter) uncompressedHeader() http.Header {
+	header := cw.Header().Clone()
+	if cw.encoder != nil {
+		header.Del("Content-Encoding")
+		if cw.etag != "" {
+			header.Set("ETag", cw.etag)
+		}
+	}
+
+	return header
+}
+
+// compressedVariant returns the body of the cached response compressed with the encoding.
+// If compressed variants are enabled they are read from and written to the store
+// next to the response and expire with it.
+func (cm cacheManager) compressedVariant(key string, cached entry, encoding Encoding) ([]byte, error) {
+	if !cm.CompressedVariants {
+		return compress(encoding, cached.Body)
+	}
+
+	variantKey := key + ";" + string(encoding)
+	if data, result := cm.lookup(variantKey); result == lookupHit {
+		if variant, err := decodeEntry(data); err == nil && variant.Created.Equal(cached.Created) {
+			return variant.Body, nil
+		}
+	}
+
+	body, err := compress(encoding, cached.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := cm.ttl()
+	if remaining, ok := cached.ttl(cm.Clock.Now()); ok {
+		ttl = remaining
+	}
+	if ttl > 0 {
+		data, err := encodeEntry(entry{Created: cached.Created, Expires: cached.Expires, Body: body})
+		if err != nil {
+			return nil, err
+		}
+		cm.saveWithTTL(variantKey, data, ttl)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,304 @@
+package cache_handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decompress(t *testing.T, encoding string, data []byte) string {
+	var (
+		r   io.Reader
+		err error
+	)
+	switch Encoding(encoding) {
+	case Gzip:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case Brotli:
+		r = brotli.NewReader(bytes.NewReader(data))
+	case Zstd:
+		var dec *zstd.Decoder
+		dec, err = zstd.NewReader(bytes.NewReader(data))
+		r = dec
+	default:
+		return string(data)
+	}
+	require.NoError(t, err)
+
+	plain, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(plain)
+}
+
+func mustKey(t *testing.T, r *http.Request) string {
+	key, err := cacheManager{KeyParts: []KeyPart{UsePathKey{}}}.keyFromRequest(r)
+	require.NoError(t, err)
+	return key
+}
+
+func TestCompress(t *testing.T) {
+	for _, encoding := range defaultEncodings {
+		compressed, err := compress(encoding, []byte("content content content"))
+		assert.NoError(t, err)
+		assert.Equal(t, "content content content", decompress(t, string(encoding), compressed))
+	}
+}
+
+func TestCompressUnknownEncoding(t *testing.T) {
+	assert.Nil(t, newEncoder("deflate", io.Discard))
+	_, err := compress("deflate", []byte("content"))
+	assert.EqualError(t, err, `unknown encoding "deflate"`)
+
+	cw, w := newCompressWriter(httptest.NewRecorder(), "deflate")
+	w.Write([]byte("content"))
+	assert.Empty(t, cw.Header().Get("Content-Encoding"))
+}
+
+func TestWithCompressionUnknownEncoding(t *testing.T) {
+	assert.PanicsWithValue(t, `cache_handler: unknown encoding "deflate", expected one of br, zstd, gzip`, func() {
+		WithCompression(Gzip, "deflate")
+	})
+	assert.NotPanics(t, func() { WithCompression() })
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for acceptEncoding, expected := range map[string]Encoding{
+		"":                           "",
+		"identity":                   "",
+		"deflate":                    "",
+		"gzip":                       Gzip,
+		"gzip, br":                   Brotli,
+		"GZIP, zstd":                 Zstd,
+		"br;q=0.5, gzip;q=0.8":       Gzip,
+		"br;q=0, gzip":               Gzip,
+		"*":                          Brotli,
+		"*;q=0.5, zstd":              Zstd,
+		"gzip;q=0.5, identity":       "",
+		"gzip;q=0, br;q=0, zstd;q=0": "",
+	} {
+		assert.Equal(t, expected, negotiateEncoding(acceptEncoding, defaultEncodings), acceptEncoding)
+	}
+	assert.Equal(t, Gzip, negotiateEncoding("gzip, br", []Encoding{Gzip, Brotli}))
+	assert.Equal(t, Encoding(""), negotiateEncoding("gzip", nil))
+}
+
+func TestIsCompressible(t *testing.T) {
+	assert.True(t, isCompressible(http.StatusOK, http.Header{}))
+	assert.True(t, isCompressible(http.StatusNotFound, http.Header{"Content-Type": {"text/html; charset=utf-8"}}))
+	assert.True(t, isCompressible(http.StatusOK, http.Header{"Content-Type": {"image/svg+xml"}}))
+	assert.False(t, isCompressible(http.StatusOK, http.Header{"Content-Type": {"image/png"}}))
+	assert.False(t, isCompressible(http.StatusOK, http.Header{"Content-Type": {"application/zip"}}))
+	assert.False(t, isCompressible(http.StatusOK, http.Header{"Content-Encoding": {"gzip"}}))
+	assert.False(t, isCompressible(http.StatusNoContent, http.Header{}))
+	assert.False(t, isCompressible(http.StatusPartialContent, http.Header{}))
+}
+
+func TestAddVary(t *testing.T) {
+	header := http.Header{}
+	addVary(header, "Accept-Encoding")
+	addVary(header, "Accept-Encoding")
+	assert.Equal(t, []string{"Accept-Encoding"}, header.Values("Vary"))
+
+	header = http.Header{"Vary": {"Origin, accept-encoding"}}
+	addVary(header, "Accept-Encoding")
+	assert.Equal(t, []string{"Origin, accept-encoding"}, header.Values("Vary"))
+
+	header = http.Header{"Vary": {"Origin"}}
+	addVary(header, "Accept-Encoding")
+	assert.Equal(t, []string{"Origin", "Accept-Encoding"}, header.Values("Vary"))
+}
+
+func TestMiddlewareCompression(t *testing.T) {
+	calls := 0
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Empty(t, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(strings.Repeat("content ", 32)))
+	}, s, WithCompression())
+
+	serve := func(acceptEncoding string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/users", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		handler(w, r)
+		return w
+	}
+
+	for _, acceptEncoding := range []string{"gzip", "gzip", "br", "zstd, gzip", ""} {
+		w := serve(acceptEncoding)
+		encoding := string(negotiateEncoding(acceptEncoding, defaultEncodings))
+		assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Equal(t, strings.Repeat("content ", 32), decompress(t, encoding, w.Body.Bytes()))
+		if encoding == "" {
+			assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+		} else {
+			assert.Equal(t, `W/"v1"`, w.Header().Get("ETag"))
+		}
+	}
+	assert.Equal(t, 1, calls)
+
+	data, err := s.Get(mustKey(t, httptest.NewRequest("GET", "/users", nil)))
+	require.NoError(t, err)
+	cached, err := decodeEntry(data)
+	require.NoError(t, err)
+	assert.Empty(t, cached.Header.Get("Content-Encoding"))
+	assert.Equal(t, `"v1"`, cached.Header.Get("ETag"))
+	assert.Equal(t, strings.Repeat("content ", 32), string(cached.Body))
+}
+
+func TestMiddlewareCompressionSkipsEncodedResponses(t *testing.T) {
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}, s, WithCompression(Gzip))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/logo.png", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		handler(w, r)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Equal(t, "png", w.Body.String())
+	}
+}
+
+func TestMiddlewareCompressedVariants(t *testing.T) {
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	s := store.NewInMemoryStore(time.Hour, store.WithClock(clock))
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}, s, WithClock(clock), WithCompression(Gzip), WithCompressedVariants())
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/users", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		handler(w, r)
+		return w
+	}
+
+	serve()
+	key := mustKey(t, httptest.NewRequest("GET", "/users", nil))
+	_, err := s.Get(key + ";gzip")
+	assert.ErrorIs(t, err, store.ErrNotFound, "the miss is compressed on the fly")
+
+	clock.Advance(time.Minute)
+	w := serve()
+	assert.Equal(t, "content", decompress(t, "gzip", w.Body.Bytes()))
+	data, err := s.Get(key + ";gzip")
+	require.NoError(t, err)
+	variant, err := decodeEntry(data)
+	require.NoError(t, err)
+	assert.Equal(t, w.Body.Bytes(), variant.Body)
+	assert.Equal(t, clock.Now().Add(59*time.Minute), variant.Expires, "variants expire with the response")
+
+	w = serve()
+	assert.Equal(t, variant.Body, w.Body.Bytes())
+}
+
+func TestMiddlewareCompressionHeadAndRange(t *testing.T) {
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("content ", 32)))
+	}, s, WithCompression(Gzip))
+
+	serve := func(method string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/users", nil)
+		r.Header = header
+		handler(w, r)
+		return w
+	}
+
+	serve("GET", http.Header{"Accept-Encoding": {"gzip"}})
+	full := serve("GET", http.Header{"Accept-Encoding": {"gzip"}})
+
+	w := serve("HEAD", http.Header{"Accept-Encoding": {"gzip"}})
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(full.Body.Len()), w.Header().Get("Content-Length"))
+	assert.Empty(t, w.Body.String())
+
+	w = serve("GET", http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-9"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, full.Body.Bytes()[:10], w.Body.Bytes())
+}
+
+func TestMiddlewareCompressionStreamed(t *testing.T) {
+	calls := 0
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("event"))
+		assert.NoError(t, http.NewResponseController(w).Flush())
+	}, s, WithCompression(Gzip))
+
+	for i := 1; i <= 2; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/events", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if i == 2 {
+			handler(unwrappingWriter{w}, r)
+		} else {
+			handler(w, r)
+		}
+		assert.True(t, w.Flushed)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "event", decompress(t, "gzip", w.Body.Bytes()))
+		assert.Equal(t, i, calls)
+	}
+}
+
+func TestMiddlewareCompressionRangeMiss(t *testing.T) {
+	calls := 0
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Empty(t, r.Header.Get("Accept-Encoding"))
+		w.Write([]byte(strings.Repeat("content ", 32)))
+	}, s, WithCompression(Gzip))
+
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/users", nil)
+		r.Header = header
+		handler(w, r)
+		return w
+	}
+
+	partial := serve(http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-9"}})
+	assert.Equal(t, http.StatusPartialContent, partial.Code)
+	assert.Equal(t, "gzip", partial.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", partial.Header().Get("Vary"))
+
+	full := serve(http.Header{"Accept-Encoding": {"gzip"}})
+	assert.Equal(t, strings.Repeat("content ", 32), decompress(t, "gzip", full.Body.Bytes()))
+	assert.Equal(t, full.Body.Bytes()[:10], partial.Body.Bytes())
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	cache_handler "github.com/StevenCyb/cache_handler"
+	"github.com/StevenCyb/cache_handler/store"
+)
+
+// Setup holds the stores and middleware options built from a config
+type Setup struct {
+	// Store is the default store passed to the middleware
+	Store store.Store
+	// Stores are the named stores used by routes
+	Stores map[string]store.Store
+	// Options of the middleware
+	Options []cache_handler.Option
+}
+
+// Build validates the config and creates its stores and middleware options.
+// The store options are passed to each store.
+func (c *Config) Build(opts ...store.Option) (*Setup, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.build(func(_ string, storeConfig StoreConfig) store.Store {
+		return storeConfig.NewStore(opts...)
+	}), nil
+}
+
+// build creates the setup with stores returned by newStore,
+// which is called with an empty name for the default store
+func (c *Config) build(newStore func(name string, storeConfig StoreConfig) store.Store) *Setup {
+	setup := &Setup{
+		Store:  newStore("", c.Store),
+		Stores: map[string]store.Store{},
+	}
+	for name, storeConfig := range c.Stores {
+		setup.Stores[name] = newStore(name, storeConfig)
+	}
+	setup.Options = c.Options(setup.Stores)
+
+	return setup
+}
+
+// Handler creates a handler func that serves responses of next from the cache
+func (s *Setup) Handler(next http.HandlerFunc, opts ...cache_handler.Option) http.HandlerFunc {
+	return cache_handler.NewMiddleware(next, s.Store, slices.Concat(s.Options, opts)...)
+}
+
+// Middleware creates a middleware that serves responses of the next handler from the cache
+func (s *Setup) Middleware(opts ...cache_handler.Option) func(http.Handler) http.Handler {
+	return cache_handler.Middleware(s.Store, slices.Concat(s.Options, opts)...)
+}
+
+// Close all stores of the setup
+func (s *Setup) Close() error {
+	errs := []error{s.Store.Close()}
+	for _, store := range s.Stores {
+		errs = append(errs, store.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewStore creates the store defined by the config,
+// the config is expected to be valid
+func (c StoreConfig) NewStore(opts ...store.Option) store.Store {
+	if c.MaxEntrySize > 0 {
+		opts = append(slices.Clip(opts), store.WithMaxEntrySize(c.MaxEntrySize))
+	}
+
+	var s store.Store
+	switch c.Type {
+	case "filesystem":
+		s = store.NewFilesystem(c.Path, c.Expiration, opts...)
+	case "redis":
+		s = store.NewRedisStore(c.Redis.Addr, c.Redis.DB, c.Redis.Username, c.Redis.Password, c.Expiration, opts...)
+	default:
+		s = store.NewInMemoryStore(c.Expiration, opts...)
+	}
+	if c.Compression.Codec != "" {
+		s = store.NewCompressionStore(s, storeCodecs[c.Compression.Codec], c.Compression.Threshold, opts...)
+	}
+
+	return s
+}
+
+// Options returns the middleware options defined by the config,
+// stores are the named stores used by routes
+func (c *Config) Options(stores map[string]store.Store) []cache_handler.Option {
+	opts := c.Policy.options()
+	opts = append(opts, cache_handler.WithStoreFailurePolicy(storeFailurePolicy[c.StoreFailurePolicy]))
+	if c.CacheStatusHeader != "" {
+		opts = append(opts, cache_handler.WithCacheStatusHeader(c.CacheStatusHeader, false))
+	}
+	if c.AgeHeader {
+		opts = append(opts, cache_handler.WithAgeHeader())
+	}
+
+	for _, route := range c.Routes {
+		routeOpts := route.Policy.options()
+		if route.Store != "" {
+			routeOpts = append(routeOpts, cache_handler.WithStore(stores[route.Store]))
+		}
+		if route.Disabled {
+			routeOpts = append(routeOpts, cache_handler.WithoutCache())
+		}
+		opts = append(opts, cache_handler.WithRoute(route.Pattern, routeOpts...))
+	}
+
+	return opts
+}
+
+// options returns the middleware options of the policy
+func (p Policy) options() []cache_handler.Option {
+	opts := []cache_handler.Option{}
+	if p.TTL > 0 {
+		opts = append(opts, cache_handler.WithTTL(p.TTL))
+	}
+	if p.MaxBodySize > 0 {
+		opts = append(opts, cache_handler.WithMaxBodySize(p.MaxBodySize))
+	}
+	if p.UncacheableTTL > 0 {
+		opts = append(opts, cache_handler.WithUncacheableTTL(p.UncacheableTTL))
+	}
+	if len(p.CacheableStatus) > 0 {
+		opts = append(opts, cache_handler.WithCacheableStatus(p.CacheableStatus...))
+	}
+	for _, status := range p.StatusTTL {
+		opts = append(opts, cache_handler.WithStatusTTL(status.Status, status.TTL))
+	}
+	if len(p.CacheableMethods) > 0 {
+		opts = append(opts, cache_handler.WithCacheableMethods(p.CacheableMethods...))
+	}
+	if len(p.Compression) > 0 {
+		encodings := make([]cache_handler.Encoding, len(p.Compression))
+		for i, encoding := range p.Compression {
+			encodings[i] = cache_handler.Encoding(encoding)
+		}
+		opts = append(opts, cache_handler.WithCompression(encodings...))
+	}
+	if p.CompressedVariants {
+		opts = append(opts, cache_handler.WithCompressedVariants())
+	}
+	if p.AllowSetCookie {
+		opts = append(opts, cache_handler.WithAllowSetCookie())
+	}
+	if p.AllowPrivate {
+		opts = append(opts, cache_handler.WithAllowPrivate())
+	}
+	if p.AllowCredentials {
+		opts = append(opts, cache_handler.WithAllowCredentials())
+	}
+
+	for _, key := range p.Keys {
+		switch key.Type {
+		case "path":
+			opts = append(opts, cache_handler.UsePathKey{})
+		case "method":
+			opts = append(opts, cache_handler.UseMethodKey{})
+		case "query":
+			opts = append(opts, cache_handler.UseQueryParamsKey{Key: key.Name})
+		case "query_all":
+			opts = append(opts, cache_handler.UseQueryKey{Include: key.Include, Exclude: key.Exclude})
+		case "header":
+			opts = append(opts, cache_handler.UseHeaderKey{Key: key.Name})
+		case "cookie":
+			opts = append(opts, cache_handler.UseCookieKey{Key: key.Name})
+		case "host":
+			opts = append(opts, cache_handler.UseHostKey{})
+		case "scheme":
+			opts = append(opts, cache_handler.UseSchemeKey{TrustedProxies: key.TrustedProxies})
+		case "remote_ip":
+			opts = append(opts, cache_handler.UseRemoteIPKey{TrustedProxies: key.TrustedProxies})
+		case "body":
+			opts = append(opts, cache_handler.UseBodyKey{MaxSize: key.MaxSize})
+		case "json_body":
+			opts = append(opts, cache_handler.UseJSONBodyKey{MaxSize: key.MaxSize})
+		case "graphql":
+			opts = append(opts, cache_handler.UseGraphQLKey{MaxSize: key.MaxSize})
+		}
+	}
+
+	for _, bypass := range p.Bypass {
+		switch bypass.Type {
+		case "header":
+			opts = append(opts, cache_handler.AllowBypassHeader{Key: bypass.Name, Value: bypass.Value})
+		case "method":
+			opts = append(opts, cache_handler.AllowBypassMethod{Key: bypass.Name})
+		}
+	}
+
+	return opts
+}
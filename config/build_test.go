@@ -0,0 +1,97 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	cfg := &Config{
+		Store:  StoreConfig{Type: "memory", Expiration: time.Minute},
+		Stores: map[string]StoreConfig{"files": {Type: "filesystem", Expiration: time.Hour, Path: t.TempDir()}},
+		Policy: Policy{
+			Keys: []Key{{Type: "query_all", Exclude: []string{"utm_*"}}},
+			Bypass: []Bypass{
+				{Type: "header", Name: "Cache-Status", Value: "bypass"},
+				{Type: "header", Name: "cache-control", Value: "no-cache"},
+			},
+		},
+		CacheStatusHeader: "api-cache",
+		Routes: []Route{
+			{Pattern: "/health", Disabled: true},
+			{Pattern: "/static/*", Store: "files"},
+			{Pattern: "/public/*", Policy: Policy{AllowCredentials: true}},
+		},
+	}
+
+	setup, err := cfg.Build()
+	require.NoError(t, err)
+	defer setup.Close()
+	assert.IsType(t, &store.InMemoryStore{}, setup.Store)
+	assert.IsType(t, &store.FilesystemStore{}, setup.Stores["files"])
+
+	calls := 0
+	handler := setup.Handler(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(strconv.Itoa(calls)))
+	})
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	assert.Equal(t, "1", get("/users?page=1", nil).Body.String())
+	w := get("/users?page=1", nil)
+	assert.Equal(t, "1", w.Body.String())
+	assert.Contains(t, w.Header().Get("Cache-Status"), "api-cache; hit")
+	assert.Equal(t, "2", get("/users?page=2", nil).Body.String())
+	assert.Equal(t, "2", get("/users?utm_source=mail&page=2", nil).Body.String())
+	assert.Equal(t, "3", get("/users?page=1", http.Header{"Cache-Status": []string{"bypass"}}).Body.String())
+	assert.Equal(t, "4", get("/users?page=1", http.Header{"Cache-Control": []string{"no-cache"}}).Body.String())
+	assert.Equal(t, "5", get("/health", nil).Body.String())
+	assert.Equal(t, "6", get("/health", nil).Body.String())
+	assert.Equal(t, "7", get("/static/app.js", nil).Body.String())
+	assert.Equal(t, "7", get("/static/app.js", nil).Body.String())
+	cookie := http.Header{"Cookie": []string{"session=secret"}}
+	assert.Equal(t, "8", get("/users?page=3", cookie).Body.String())
+	assert.Equal(t, "9", get("/users?page=3", cookie).Body.String())
+	assert.Equal(t, "10", get("/public/terms", cookie).Body.String())
+	assert.Equal(t, "10", get("/public/terms", cookie).Body.String())
+}
+
+func TestBuildInvalid(t *testing.T) {
+	_, err := (&Config{}).Build()
+	assert.Error(t, err)
+}
+
+func TestNewStore(t *testing.T) {
+	s := StoreConfig{Type: "redis", Redis: RedisConfig{Addr: "localhost:6379", DB: 3}}.NewStore()
+	defer s.Close()
+	assert.IsType(t, &store.RedisStore{}, s)
+	assert.Equal(t, 3, s.(*store.RedisStore).Client.Options().DB)
+}
+
+func TestNewStoreWithCompression(t *testing.T) {
+	s := StoreConfig{Type: "memory", Expiration: time.Minute, Compression: CompressionConfig{Codec: "zstd", Threshold: 16}}.NewStore()
+	defer s.Close()
+	assert.IsType(t, &store.CompressionStore{}, s)
+
+	content := []byte(strings.Repeat("content ", 16))
+	assert.NoError(t, s.Set("key", content))
+	data, err := s.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+}
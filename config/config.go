@@ -0,0 +1,188 @@
+// Package config builds stores and middleware options from a YAML or JSON document.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config of the cache.
+// The policy fields apply to all requests, routes override them for matching requests.
+type Config struct {
+	// Store is the default store
+	Store StoreConfig `yaml:"store"`
+	// Stores are named stores routes can use instead of the default store
+	Stores map[string]StoreConfig `yaml:"stores"`
+	Policy `yaml:",inline"`
+	// StoreFailurePolicy is one of `fail_open` (default), `fail_closed` or `circuit_break`
+	StoreFailurePolicy string `yaml:"store_failure_policy"`
+	// CacheStatusHeader adds the `Cache-Status` header with the name of the cache
+	CacheStatusHeader string `yaml:"cache_status_header"`
+	// AgeHeader adds the `Age` header to responses served from the cache
+	AgeHeader bool `yaml:"age_header"`
+	// Routes with their own policy, the first matching route is used
+	Routes []Route `yaml:"routes"`
+}
+
+// StoreConfig defines a store
+type StoreConfig struct {
+	// Type is one of `memory`, `filesystem` or `redis`
+	Type string `yaml:"type"`
+	// Expiration of entries
+	Expiration time.Duration `yaml:"expiration"`
+	// MaxEntrySize limits the size of entries in bytes
+	MaxEntrySize int `yaml:"max_entry_size"`
+	// Path of the directory used by the filesystem store
+	Path string `yaml:"path"`
+	// Redis connection used by the redis store
+	Redis RedisConfig `yaml:"redis"`
+	// Compression of stored entries
+	Compression CompressionConfig `yaml:"compression"`
+}
+
+// CompressionConfig defines how a store compresses entries
+type CompressionConfig struct {
+	// Codec is one of `gzip`, `snappy` or `zstd`, entries are not compressed if empty
+	Codec string `yaml:"codec"`
+	// Threshold is the size in bytes from which on entries are compressed
+	Threshold int `yaml:"threshold"`
+}
+
+// RedisConfig defines the connection of a redis store
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+// Policy defines how requests are cached
+type Policy struct {
+	// TTL of cached responses, by default the expiration of the store is used
+	TTL time.Duration `yaml:"ttl"`
+	// MaxBodySize of cached responses in bytes
+	MaxBodySize int `yaml:"max_body_size"`
+	// UncacheableTTL is how long responses larger than MaxBodySize are not recorded again
+	UncacheableTTL time.Duration `yaml:"uncacheable_ttl"`
+	// CacheableStatus codes of cached responses, by default the heuristically cacheable codes of RFC 9110
+	CacheableStatus []int `yaml:"cacheable_status"`
+	// StatusTTL adds status codes to the cacheable codes with their own TTL
+	StatusTTL []StatusTTL `yaml:"status_ttl"`
+	// CacheableMethods of cached requests, by default GET and HEAD
+	CacheableMethods []string `yaml:"cacheable_methods"`
+	// Compression encodings (`br`, `zstd`, `gzip`) responses are compressed with in order of preference
+	Compression []string `yaml:"compression"`
+	// CompressedVariants are stored next to the uncompressed response, if compression is used
+	CompressedVariants bool `yaml:"compressed_variants"`
+	// AllowSetCookie stores responses that set cookies, without the `Set-Cookie` header
+	AllowSetCookie bool `yaml:"allow_set_cookie"`
+	// AllowPrivate stores responses with `Cache-Control: private`
+	AllowPrivate bool `yaml:"allow_private"`
+	// AllowCredentials serves requests with `Authorization` or `Cookie` headers from the cache
+	// even if the keys don't include them
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// Keys are added to the cache key
+	Keys []Key `yaml:"keys"`
+	// Bypass rules allow requests to bypass the cache
+	Bypass []Bypass `yaml:"bypass"`
+}
+
+// StatusTTL is the TTL of responses with a status code
+type StatusTTL struct {
+	Status int `yaml:"status"`
+	// TTL of the responses, by default the TTL of the policy
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Key is a part of the cache key
+type Key struct {
+	// Type is one of `path`, `method`, `query`, `query_all`, `header`,
+	// `cookie`, `host`, `scheme`, `remote_ip`, `body`, `json_body` or `graphql`
+	Type string `yaml:"type"`
+	// Name of the query parameter, header or cookie
+	Name string `yaml:"name"`
+	// Include are the names or globs of the parameters used by a `query_all` key, by default all
+	Include []string `yaml:"include"`
+	// Exclude are the names or globs of the parameters ignored by a `query_all` key
+	Exclude []string `yaml:"exclude"`
+	// TrustedProxies are the IP addresses or CIDR ranges of proxies
+	// whose forwarding headers are used by `scheme` and `remote_ip` keys
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// MaxSize of request bodies in bytes used by `body`, `json_body` and `graphql` keys, by default 1MB
+	MaxSize int64 `yaml:"max_size"`
+}
+
+// Bypass is a rule that allows requests to bypass the cache
+type Bypass struct {
+	// Type is one of `header` or `method`
+	Type string `yaml:"type"`
+	// Name of the header or method
+	Name string `yaml:"name"`
+	// Value of the header
+	Value string `yaml:"value"`
+}
+
+// Route applies its policy to requests that match the pattern
+type Route struct {
+	// Pattern of the form `[METHOD ]PATH`, see cache_handler.WithRoute
+	Pattern string `yaml:"pattern"`
+	Policy  `yaml:",inline"`
+	// Store is the name of a store defined in Stores
+	Store string `yaml:"store"`
+	// Disabled passes matching requests to the handler without caching
+	Disabled bool `yaml:"disabled"`
+}
+
+// Parse decodes a YAML or JSON document and validates it.
+// Unknown fields are rejected.
+func Parse(data []byte) (*Config, error) {
+	cfg, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// LoadFile reads the YAML or JSON document at path,
+// applies the environment overrides and validates it
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	cfg, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// decode the document, JSON is decoded as YAML
+func decode(data []byte) (*Config, error) {
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseYAML(t *testing.T) {
+	data, err := os.ReadFile("testdata/cache.yaml")
+	require.NoError(t, err)
+
+	cfg, err := Parse(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, StoreConfig{Type: "memory", Expiration: 5 * time.Minute}, cfg.Store)
+	assert.Equal(t, map[string]StoreConfig{
+		"static": {Type: "filesystem", Expiration: 24 * time.Hour, Path: "/tmp/cache_handler_static"},
+	}, cfg.Stores)
+	assert.Equal(t, time.Minute, cfg.TTL)
+	assert.Equal(t, []Key{{Type: "method"}}, cfg.Keys)
+	assert.Equal(t, []Bypass{{Type: "header", Name: "Cache-Status", Value: "bypass"}}, cfg.Bypass)
+	assert.Equal(t, "api-cache", cfg.CacheStatusHeader)
+	assert.Equal(t, []Route{
+		{Pattern: "GET /users", Policy: Policy{TTL: 10 * time.Minute, Keys: []Key{{Type: "header", Name: "Authorization"}}}},
+		{Pattern: "/health", Disabled: true},
+		{Pattern: "/static/*", Policy: Policy{TTL: 24 * time.Hour}, Store: "static"},
+	}, cfg.Routes)
+}
+
+func TestParseJSON(t *testing.T) {
+	cfg, err := Parse([]byte(`{
+		"store": {"type": "redis", "redis": {"addr": "localhost:6379", "db": 1}},
+		"ttl": "30s",
+		"cacheable_status": [200, 404],
+		"status_ttl": [{"status": 404, "ttl": "10s"}],
+		"cacheable_methods": ["GET", "POST"],
+		"compression": ["br", "gzip"],
+		"compressed_variants": true,
+		"allow_set_cookie": true,
+		"allow_private": true,
+		"allow_credentials": true,
+		"routes": [{"pattern": "/users", "keys": [{"type": "query", "name": "page"}]}]
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, StoreConfig{Type: "redis", Redis: RedisConfig{Addr: "localhost:6379", DB: 1}}, cfg.Store)
+	assert.Equal(t, 30*time.Second, cfg.TTL)
+	assert.Equal(t, []int{200, 404}, cfg.CacheableStatus)
+	assert.Equal(t, []StatusTTL{{Status: 404, TTL: 10 * time.Second}}, cfg.StatusTTL)
+	assert.Equal(t, []string{"GET", "POST"}, cfg.CacheableMethods)
+	assert.Equal(t, []string{"br", "gzip"}, cfg.Compression)
+	assert.True(t, cfg.CompressedVariants)
+	assert.True(t, cfg.AllowSetCookie)
+	assert.True(t, cfg.AllowPrivate)
+	assert.True(t, cfg.AllowCredentials)
+	assert.Equal(t, []Route{{Pattern: "/users", Policy: Policy{Keys: []Key{{Type: "query", Name: "page"}}}}}, cfg.Routes)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte("store:\n  type: memory\n  expiration: 1m\n  size: 10\n"))
+	assert.ErrorContains(t, err, "config: yaml: unmarshal errors:\n  line 4: field size not found in type config.StoreConfig")
+
+	_, err = Parse([]byte("store:\n  type: memory\n  expiration: soon\n"))
+	assert.ErrorContains(t, err, "line 3")
+
+	_, err = Parse([]byte(""))
+	assert.EqualError(t, err, "config: store.type: is required, expected one of memory, filesystem, redis")
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Setenv("CACHE_STORE_EXPIRATION", "7m")
+	cfg, err := LoadFile("testdata/cache.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, 7*time.Minute, cfg.Store.Expiration)
+
+	t.Setenv("CACHE_TTL", "-1s")
+	_, err = LoadFile("testdata/cache.yaml")
+	assert.EqualError(t, err, "config: ttl: must not be negative")
+
+	_, err = LoadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of environment variables that override the config
+const EnvPrefix = "CACHE_"
+
+// ApplyEnv overrides the config with environment variables looked up with lookup,
+// e.g. os.LookupEnv. Supported variables are
+//   - CACHE_TTL, CACHE_MAX_BODY_SIZE, CACHE_STORE_FAILURE_POLICY,
+//     CACHE_CACHE_STATUS_HEADER and CACHE_AGE_HEADER
+//   - CACHE_STORE_TYPE, CACHE_STORE_EXPIRATION, CACHE_STORE_MAX_ENTRY_SIZE,
+//     CACHE_STORE_PATH, CACHE_STORE_REDIS_ADDR, CACHE_STORE_REDIS_USERNAME,
+//     CACHE_STORE_REDIS_PASSWORD, CACHE_STORE_REDIS_DB, CACHE_STORE_COMPRESSION_CODEC
+//     and CACHE_STORE_COMPRESSION_THRESHOLD for the default store
+//   - the same variables with CACHE_STORES_<NAME>_ instead of CACHE_STORE_
+//     for named stores, where NAME is the upper case name of the store
+//     with characters other than letters and digits replaced by `_`
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	env := envReader{lookup: lookup}
+
+	env.duration(EnvPrefix+"TTL", &c.TTL)
+	env.int(EnvPrefix+"MAX_BODY_SIZE", &c.MaxBodySize)
+	env.string(EnvPrefix+"STORE_FAILURE_POLICY", &c.StoreFailurePolicy)
+	env.string(EnvPrefix+"CACHE_STATUS_HEADER", &c.CacheStatusHeader)
+	env.bool(EnvPrefix+"AGE_HEADER", &c.AgeHeader)
+
+	env.store(EnvPrefix+"STORE_", &c.Store)
+	for name, store := range c.Stores {
+		env.store(EnvPrefix+"STORES_"+envName(name)+"_", &store)
+		c.Stores[name] = store
+	}
+
+	return errors.Join(env.errs...)
+}
+
+// envName converts the name of a store to its part of a variable name
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// envReader sets values from environment variables and collects errors
+type envReader struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+func (env *envReader) store(prefix string, store *StoreConfig) {
+	env.string(prefix+"TYPE", &store.Type)
+	env.duration(prefix+"EXPIRATION", &store.Expiration)
+	env.int(prefix+"MAX_ENTRY_SIZE", &store.MaxEntrySize)
+	env.string(prefix+"PATH", &store.Path)
+	env.string(prefix+"REDIS_ADDR", &store.Redis.Addr)
+	env.string(prefix+"REDIS_USERNAME", &store.Redis.Username)
+	env.string(prefix+"REDIS_PASSWORD", &store.Redis.Password)
+	env.int(prefix+"REDIS_DB", &store.Redis.DB)
+	env.string(prefix+"COMPRESSION_CODEC", &store.Compression.Codec)
+	env.int(prefix+"COMPRESSION_THRESHOLD", &store.Compression.Threshold)
+}
+
+func (env *envReader) string(name string, value *string) {
+	if v, ok := env.lookup(name); ok {
+		*value = v
+	}
+}
+
+func (env *envReader) int(name string, value *int) {
+	if v, ok := env.lookup(name); ok {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			env.errs = append(env.errs, fmt.Errorf("config: %s: invalid integer %q", name, v))
+			return
+		}
+		*value = i
+	}
+}
+
+func (env *envReader) bool(name string, value *bool) {
+	if v, ok := env.lookup(name); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			env.errs = append(env.errs, fmt.Errorf("config: %s: invalid boolean %q", name, v))
+			return
+		}
+		*value = b
+	}
+}
+
+func (env *envReader) duration(name string, value *time.Duration) {
+	if v, ok := env.lookup(name); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			env.errs = append(env.errs, fmt.Errorf("config: %s: invalid duration %q", name, v))
+			return
+		}
+		*value = d
+	}
+}
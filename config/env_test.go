@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lookupMap(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := &Config{
+		Store:  StoreConfig{Type: "memory", Expiration: time.Minute},
+		Stores: map[string]StoreConfig{"shared-redis": {Type: "redis"}},
+	}
+
+	err := cfg.ApplyEnv(lookupMap(map[string]string{
+		"CACHE_TTL":                                       "2m",
+		"CACHE_MAX_BODY_SIZE":                             "1024",
+		"CACHE_STORE_FAILURE_POLICY":                      "fail_closed",
+		"CACHE_CACHE_STATUS_HEADER":                       "edge",
+		"CACHE_AGE_HEADER":                                "true",
+		"CACHE_STORE_TYPE":                                "filesystem",
+		"CACHE_STORE_PATH":                                "/var/cache",
+		"CACHE_STORES_SHARED_REDIS_REDIS_ADDR":            "redis:6379",
+		"CACHE_STORES_SHARED_REDIS_REDIS_PASSWORD":        "secret",
+		"CACHE_STORES_SHARED_REDIS_REDIS_DB":              "2",
+		"CACHE_STORES_SHARED_REDIS_MAX_ENTRY_SIZE":        "512",
+		"CACHE_STORES_SHARED_REDIS_COMPRESSION_CODEC":     "snappy",
+		"CACHE_STORES_SHARED_REDIS_COMPRESSION_THRESHOLD": "256",
+	}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, cfg.TTL)
+	assert.Equal(t, 1024, cfg.MaxBodySize)
+	assert.Equal(t, "fail_closed", cfg.StoreFailurePolicy)
+	assert.Equal(t, "edge", cfg.CacheStatusHeader)
+	assert.True(t, cfg.AgeHeader)
+	assert.Equal(t, StoreConfig{Type: "filesystem", Expiration: time.Minute, Path: "/var/cache"}, cfg.Store)
+	assert.Equal(t, StoreConfig{
+		Type:         "redis",
+		MaxEntrySize: 512,
+		Redis:        RedisConfig{Addr: "redis:6379", Password: "secret", DB: 2},
+		Compression:  CompressionConfig{Codec: "snappy", Threshold: 256},
+	}, cfg.Stores["shared-redis"])
+}
+
+func TestApplyEnvErrors(t *testing.T) {
+	cfg := &Config{Policy: Policy{TTL: time.Minute}}
+
+	err := cfg.ApplyEnv(lookupMap(map[string]string{
+		"CACHE_TTL":            "1 minute",
+		"CACHE_AGE_HEADER":     "sure",
+		"CACHE_STORE_REDIS_DB": "first",
+	}))
+
+	assert.EqualError(t, err, "config: CACHE_TTL: invalid duration \"1 minute\"\n"+
+		"config: CACHE_AGE_HEADER: invalid boolean \"sure\"\n"+
+		"config: CACHE_STORE_REDIS_DB: invalid integer \"first\"")
+	assert.Equal(t, time.Minute, cfg.TTL)
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	cache_handler "github.com/StevenCyb/cache_handler"
+	"github.com/StevenCyb/cache_handler/clock"
+	"github.com/StevenCyb/cache_handler/store"
+)
+
+// FileProvider is a cache_handler.Provider that reloads a config file
+// on SIGHUP and when the modification time of the file changes.
+// Stores whose definition did not change are reused with their cached data,
+// stores that are no longer used are closed once no request uses them.
+type FileProvider struct {
+	path         string
+	storeOptions []store.Option
+	signals      []os.Signal
+	interval     time.Duration
+	logger       *slog.Logger
+	clock        clock.Clock
+
+	mutex   sync.Mutex
+	setup   *Setup
+	configs map[store.Store]storeDefinition
+	modTime time.Time
+}
+
+// ProviderOption configures a FileProvider
+type ProviderOption func(p *FileProvider)
+
+// WithStoreOptions sets the options passed to the stores created by the provider
+func WithStoreOptions(opts ...store.Option) ProviderOption {
+	return func(p *FileProvider) {
+		p.storeOptions = opts
+	}
+}
+
+// WithSignals sets the signals that reload the config, by default SIGHUP
+func WithSignals(signals ...os.Signal) ProviderOption {
+	return func(p *FileProvider) {
+		p.signals = signals
+	}
+}
+
+// WithPollInterval sets how often the modification time of the file is checked,
+// by default every 5s. Use 0 to only reload on signals.
+func WithPollInterval(interval time.Duration) ProviderOption {
+	return func(p *FileProvider) {
+		p.interval = interval
+	}
+}
+
+// WithLogger sets the logger the provider reports reloads and invalid configs to
+func WithLogger(logger *slog.Logger) ProviderOption {
+	return func(p *FileProvider) {
+		if logger != nil {
+			p.logger = logger
+		}
+	}
+}
+
+// WithClock sets the clock used to poll the file
+func WithClock(c clock.Clock) ProviderOption {
+	return func(p *FileProvider) {
+		if c != nil {
+			p.clock = c
+		}
+	}
+}
+
+// NewFileProvider loads the config file at path with LoadFile and builds its stores
+func NewFileProvider(path string, opts ...ProviderOption) (*FileProvider, error) {
+	p := &FileProvider{
+		path:     path,
+		signals:  []os.Signal{syscall.SIGHUP},
+		interval: 5 * time.Second,
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		clock:    clock.Real,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	modTime, err := p.stat()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p.modTime = modTime
+	p.setup, p.configs = cfg.buildReusing(nil, p.storeOptions)
+
+	return p, nil
+}
+
+// Setup returns the current stores and options
+func (p *FileProvider) Setup() *Setup {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.setup
+}
+
+// NewCache creates a cache_handler.Cache with the current stores and options
+func (p *FileProvider) NewCache(opts ...cache_handler.Option) *cache_handler.Cache {
+	setup := p.Setup()
+	return cache_handler.NewCache(setup.Store, slices.Concat(setup.Options, opts)...)
+}
+
+// Watch reloads the config on signals and changes of the file until ctx is done
+func (p *FileProvider) Watch(ctx context.Context, reload func(store.Store, ...cache_handler.Option) <-chan struct{}) error {
+	signals := make(chan os.Signal, 1)
+	if len(p.signals) > 0 {
+		signal.Notify(signals, p.signals...)
+		defer signal.Stop(signals)
+	}
+
+	var poll <-chan time.Time
+	for {
+		if p.interval > 0 {
+			poll = p.clock.After(p.interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sig := <-signals:
+			p.logger.Info("reloading config", slog.String("path", p.path), slog.String("signal", sig.String()))
+			p.Reload(reload)
+		case <-poll:
+			modTime, err := p.stat()
+			if err != nil {
+				p.logger.Warn("failed to check config", slog.String("path", p.path), slog.Any("error", err))
+				continue
+			}
+			p.mutex.Lock()
+			changed := !modTime.Equal(p.modTime)
+			p.mutex.Unlock()
+			if changed {
+				p.logger.Info("reloading changed config", slog.String("path", p.path))
+				p.Reload(reload)
+			}
+		}
+	}
+}
+
+// Reload loads the config file and passes the new stores and options to reload.
+// If the config is invalid the current stores and options are kept.
+func (p *FileProvider) Reload(reload func(store.Store, ...cache_handler.Option) <-chan struct{}) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	modTime, err := p.stat()
+	if err != nil {
+		p.logger.Error("failed to reload config", slog.String("path", p.path), slog.Any("error", err))
+		return err
+	}
+	p.modTime = modTime
+
+	cfg, err := LoadFile(p.path)
+	if err != nil {
+		p.logger.Error("failed to reload config, keeping the current config",
+			slog.String("path", p.path), slog.Any("error", err))
+		return err
+	}
+
+	previous := p.configs
+	p.setup, p.configs = cfg.buildReusing(previous, p.storeOptions)
+
+	unused := []store.Store{}
+	for s := range previous {
+		if _, ok := p.configs[s]; !ok {
+			unused = append(unused, s)
+		}
+	}
+
+	drained := reload(p.setup.Store, p.setup.Options...)
+	if len(unused) > 0 {
+		go func() {
+			<-drained
+			for _, s := range unused {
+				if err := s.Close(); err != nil {
+					p.logger.Warn("failed to close unused store", slog.Any("error", err))
+				}
+			}
+		}()
+	}
+	p.logger.Info("config reloaded", slog.String("path", p.path),
+		slog.Int("stores_reused", len(previous)-len(unused)), slog.Int("stores_closed", len(unused)))
+
+	return nil
+}
+
+// Close all stores of the provider
+func (p *FileProvider) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.setup.Close()
+}
+
+func (p *FileProvider) stat() (time.Time, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("config: %w", err)
+	}
+
+	return info.ModTime(), nil
+}
+
+// storeDefinition is the name and config of a store,
+// the default store has no name
+type storeDefinition struct {
+	name   string
+	config StoreConfig
+}
+
+// buildReusing builds the config, stores of previous with the same name and config are reused.
+// It returns the setup together with the definition of each store.
+func (c *Config) buildReusing(previous map[store.Store]storeDefinition, opts []store.Option) (*Setup, map[store.Store]storeDefinition) {
+	available := map[storeDefinition]store.Store{}
+	for s, definition := range previous {
+		available[definition] = s
+	}
+
+	definitions := map[store.Store]storeDefinition{}
+	newStore := func(name string, storeConfig StoreConfig) store.Store {
+		definition := storeDefinition{name: name, config: storeConfig}
+		s, ok := available[definition]
+		if !ok {
+			s = storeConfig.NewStore(opts...)
+		}
+		definitions[s] = definition
+
+		return s
+	}
+
+	return c.build(newStore), definitions
+}
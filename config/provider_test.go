@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cache_handler "github.com/StevenCyb/cache_handler"
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const providerConfig = `
+store:
+  type: memory
+  expiration: 1h
+stores:
+  static:
+    type: memory
+    expiration: %s
+routes:
+  - pattern: /static/*
+    store: static
+`
+
+func writeConfig(t *testing.T, path, expiration string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(providerConfig, "%s", expiration, 1)), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.yaml")
+	modTime := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+	writeConfig(t, path, "1h", modTime)
+
+	clock := clocktest.NewFake(modTime)
+	provider, err := NewFileProvider(path, WithClock(clock), WithSignals(), WithPollInterval(time.Second))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	first := provider.Setup()
+	cache := provider.NewCache()
+	calls := 0
+	handler := cache.Handler(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(strconv.Itoa(calls)))
+	})
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w.Body.String()
+	}
+	assert.Equal(t, "1", get("/users"))
+	assert.Equal(t, "2", get("/static/app.js"))
+
+	reloaded := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go provider.Watch(ctx, func(s store.Store, opts ...cache_handler.Option) <-chan struct{} {
+		drained := cache.Reload(s, opts...)
+		reloaded <- struct{}{}
+		return drained
+	})
+
+	writeConfig(t, path, "2h", modTime.Add(time.Minute))
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-reloaded
+
+	second := provider.Setup()
+	assert.Same(t, first.Store, second.Store)
+	assert.NotSame(t, first.Stores["static"], second.Stores["static"])
+	assert.Equal(t, "1", get("/users"))
+	assert.Equal(t, "3", get("/static/app.js"))
+	assert.Eventually(t, func() bool {
+		_, err := first.Stores["static"].Get("key")
+		return errors.Is(err, store.ErrClosed)
+	}, time.Second, time.Millisecond)
+}
+
+func TestFileProviderRenamedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.yaml")
+	writeConfig(t, path, "1h", time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+
+	provider, err := NewFileProvider(path, WithSignals(), WithPollInterval(0))
+	require.NoError(t, err)
+	defer provider.Close()
+	first := provider.Setup()
+
+	renamed := strings.ReplaceAll(strings.Replace(providerConfig, "%s", "1h", 1), "static", "assets")
+	require.NoError(t, os.WriteFile(path, []byte(renamed), 0o600))
+	drained := make(chan struct{})
+	require.NoError(t, provider.Reload(func(store.Store, ...cache_handler.Option) <-chan struct{} {
+		return drained
+	}))
+
+	second := provider.Setup()
+	assert.Same(t, first.Store, second.Store)
+	require.Contains(t, second.Stores, "assets")
+	assert.NotSame(t, first.Stores["static"], second.Stores["assets"], "a renamed store is not reused")
+
+	_, err = first.Stores["static"].Get("key")
+	assert.ErrorIs(t, err, store.ErrNotFound, "the old store is closed after draining")
+	close(drained)
+	assert.Eventually(t, func() bool {
+		_, err := first.Stores["static"].Get("key")
+		return errors.Is(err, store.ErrClosed)
+	}, time.Second, time.Millisecond)
+	_, err = second.Stores["assets"].Get("key")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestFileProviderKeepsConfigOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.yaml")
+	modTime := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+	writeConfig(t, path, "1h", modTime)
+
+	provider, err := NewFileProvider(path, WithSignals(), WithPollInterval(0))
+	require.NoError(t, err)
+	defer provider.Close()
+	first := provider.Setup()
+
+	require.NoError(t, os.WriteFile(path, []byte("store:\n  type: memcached\n"), 0o600))
+	err = provider.Reload(func(store.Store, ...cache_handler.Option) <-chan struct{} {
+		t.Fatal("reloaded an invalid config")
+		return nil
+	})
+	assert.EqualError(t, err, `config: store.type: unknown store type "memcached", expected one of memory, filesystem, redis`)
+	assert.Same(t, first, provider.Setup())
+}
+
+func TestNewFileProviderErrors(t *testing.T) {
+	_, err := NewFileProvider(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
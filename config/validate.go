@@ -0,0 +1,263 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"sort"
+	"strings"
+
+	cache_handler "github.com/StevenCyb/cache_handler"
+	"github.com/StevenCyb/cache_handler/store"
+)
+
+var (
+	storeTypes         = []string{"memory", "filesystem", "redis"}
+	keyTypes           = []string{"path", "method", "query", "query_all", "header", "cookie", "host", "scheme", "remote_ip", "body", "json_body", "graphql"}
+	bypassTypes        = []string{"header", "method"}
+	encodings          = []string{"br", "zstd", "gzip"}
+	storeCodecs        = map[string]store.Codec{"gzip": store.CodecGzip, "snappy": store.CodecSnappy, "zstd": store.CodecZstd}
+	storeFailurePolicy = map[string]cache_handler.StoreFailurePolicy{
+		"":              cache_handler.FailOpen,
+		"fail_open":     cache_handler.FailOpen,
+		"fail_closed":   cache_handler.FailClosed,
+		"circuit_break": cache_handler.CircuitBreak,
+	}
+)
+
+// Validate checks the config and returns all problems found,
+// each prefixed with the field it refers to like `routes[1].keys[0].name`
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.store("store", c.Store)
+	names := make([]string, 0, len(c.Stores))
+	for name := range c.Stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "" {
+			v.errorf("stores", "store name must not be empty")
+		}
+		v.store(fmt.Sprintf("stores.%s", name), c.Stores[name])
+	}
+
+	v.policy("", c.Policy)
+	if _, ok := storeFailurePolicy[c.StoreFailurePolicy]; !ok {
+		v.errorf("store_failure_policy", "unknown policy %q, expected one of fail_open, fail_closed, circuit_break", c.StoreFailurePolicy)
+	}
+
+	for i, route := range c.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+		if route.Pattern == "" {
+			v.errorf(field+".pattern", "is required")
+		} else if err := cache_handler.CheckRoutePattern(route.Pattern); err != nil {
+			v.errorf(field+".pattern", "%v", err)
+		}
+		if _, ok := c.Stores[route.Store]; route.Store != "" && !ok {
+			v.errorf(field+".store", "unknown store %q", route.Store)
+		}
+		v.policy(field+".", route.Policy)
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// validator collects the problems of a config
+type validator struct {
+	errs []error
+}
+
+func (v *validator) errorf(field, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("config: %s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) oneOf(field, kind, value string, values []string) bool {
+	for _, allowed := range values {
+		if value == allowed {
+			return true
+		}
+	}
+	if value == "" {
+		v.errorf(field, "is required, expected one of %s", strings.Join(values, ", "))
+	} else {
+		v.errorf(field, "unknown %s %q, expected one of %s", kind, value, strings.Join(values, ", "))
+	}
+
+	return false
+}
+
+func (v *validator) store(field string, store StoreConfig) {
+	if !v.oneOf(field+".type", "store type", store.Type, storeTypes) {
+		return
+	}
+	if store.Expiration < 0 {
+		v.errorf(field+".expiration", "must not be negative")
+	} else if store.Expiration == 0 && store.Type != "redis" {
+		v.errorf(field+".expiration", "is required for a %s store", store.Type)
+	}
+	if store.MaxEntrySize < 0 {
+		v.errorf(field+".max_entry_size", "must not be negative")
+	}
+
+	switch store.Type {
+	case "filesystem":
+		if store.Path == "" {
+			v.errorf(field+".path", "is required for a filesystem store")
+		}
+	case "redis":
+		if store.Redis.Addr == "" {
+			v.errorf(field+".redis.addr", "is required for a redis store")
+		}
+		if store.Redis.DB < 0 {
+			v.errorf(field+".redis.db", "must not be negative")
+		}
+	}
+	if store.Compression.Codec != "" {
+		if _, ok := storeCodecs[store.Compression.Codec]; !ok {
+			v.errorf(field+".compression.codec", "unknown codec %q, expected one of gzip, snappy, zstd", store.Compression.Codec)
+		}
+	}
+	if store.Compression.Threshold < 0 {
+		v.errorf(field+".compression.threshold", "must not be negative")
+	}
+	if store.Type != "filesystem" && store.Path != "" {
+		v.errorf(field+".path", "is only supported by a filesystem store")
+	}
+	if store.Type != "redis" && store.Redis != (RedisConfig{}) {
+		v.errorf(field+".redis", "is only supported by a redis store")
+	}
+}
+
+func (v *validator) policy(prefix string, policy Policy) {
+	if policy.TTL < 0 {
+		v.errorf(prefix+"ttl", "must not be negative")
+	}
+	if policy.MaxBodySize < 0 {
+		v.errorf(prefix+"max_body_size", "must not be negative")
+	}
+	if policy.UncacheableTTL < 0 {
+		v.errorf(prefix+"uncacheable_ttl", "must not be negative")
+	}
+	for i, status := range policy.CacheableStatus {
+		if status < 100 || status > 999 {
+			v.errorf(fmt.Sprintf("%scacheable_status[%d]", prefix, i), "invalid status code %d", status)
+		}
+	}
+	for i, status := range policy.StatusTTL {
+		field := fmt.Sprintf("%sstatus_ttl[%d]", prefix, i)
+		if status.Status < 100 || status.Status > 999 {
+			v.errorf(field+".status", "invalid status code %d", status.Status)
+		}
+		if status.TTL < 0 {
+			v.errorf(field+".ttl", "must not be negative")
+		}
+	}
+	for i, encoding := range policy.Compression {
+		v.oneOf(fmt.Sprintf("%scompression[%d]", prefix, i), "encoding", encoding, encodings)
+	}
+	for i, method := range policy.CacheableMethods {
+		if !validMethod(method) {
+			v.errorf(fmt.Sprintf("%scacheable_methods[%d]", prefix, i), "unknown method %q", method)
+		}
+	}
+
+	for i, key := range policy.Keys {
+		field := fmt.Sprintf("%skeys[%d]", prefix, i)
+		if !v.oneOf(field+".type", "key type", key.Type, keyTypes) {
+			continue
+		}
+		switch key.Type {
+		case "query", "header", "cookie":
+			if key.Name == "" {
+				v.errorf(field+".name", "is required for a %s key", key.Type)
+			}
+		default:
+			if key.Name != "" {
+				v.errorf(field+".name", "is not supported by a %s key", key.Type)
+			}
+		}
+		if key.Type != "query_all" {
+			if len(key.Include) > 0 {
+				v.errorf(field+".include", "is only supported by a query_all key")
+			}
+			if len(key.Exclude) > 0 {
+				v.errorf(field+".exclude", "is only supported by a query_all key")
+			}
+		}
+		if key.Type != "scheme" && key.Type != "remote_ip" && len(key.TrustedProxies) > 0 {
+			v.errorf(field+".trusted_proxies", "is only supported by scheme and remote_ip keys")
+		}
+		switch key.Type {
+		case "body", "json_body", "graphql":
+			if key.MaxSize < 0 {
+				v.errorf(field+".max_size", "must not be negative")
+			}
+		default:
+			if key.MaxSize != 0 {
+				v.errorf(field+".max_size", "is only supported by body, json_body and graphql keys")
+			}
+		}
+		for j, proxy := range key.TrustedProxies {
+			if !validProxy(proxy) {
+				v.errorf(fmt.Sprintf("%s.trusted_proxies[%d]", field, j), "invalid IP address or CIDR range %q", proxy)
+			}
+		}
+		for j, pattern := range append(key.Include, key.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				list, index := "include", j
+				if j >= len(key.Include) {
+					list, index = "exclude", j-len(key.Include)
+				}
+				v.errorf(fmt.Sprintf("%s.%s[%d]", field, list, index), "invalid pattern %q", pattern)
+			}
+		}
+	}
+
+	for i, bypass := range policy.Bypass {
+		field := fmt.Sprintf("%sbypass[%d]", prefix, i)
+		if !v.oneOf(field+".type", "bypass type", bypass.Type, bypassTypes) {
+			continue
+		}
+		if bypass.Name == "" {
+			v.errorf(field+".name", "is required for a %s bypass", bypass.Type)
+		}
+		switch bypass.Type {
+		case "header":
+			if bypass.Value == "" {
+				v.errorf(field+".value", "is required for a header bypass")
+			}
+		case "method":
+			if bypass.Value != "" {
+				v.errorf(field+".value", "is not supported by a method bypass")
+			}
+			if bypass.Name != "" && !validMethod(bypass.Name) {
+				v.errorf(field+".name", "unknown method %q", bypass.Name)
+			}
+		}
+	}
+}
+
+// validProxy returns if the proxy is an IP address or CIDR range
+func validProxy(proxy string) bool {
+	if strings.Contains(proxy, "/") {
+		_, err := netip.ParsePrefix(proxy)
+		return err == nil
+	}
+	_, err := netip.ParseAddr(proxy)
+	return err == nil
+}
+
+// validMethod returns if the method is a standard http method
+func validMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
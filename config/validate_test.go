@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{
+		Store: StoreConfig{Type: "filesystem", Expiration: time.Minute, Redis: RedisConfig{Addr: "localhost"}},
+		Stores: map[string]StoreConfig{
+			"a": {Type: "memcached"},
+			"b": {Type: "redis", Expiration: -time.Second, Compression: CompressionConfig{Codec: "lz4", Threshold: -1}},
+		},
+		Policy: Policy{
+			TTL:              -time.Minute,
+			CacheableStatus:  []int{200, 42},
+			StatusTTL:        []StatusTTL{{Status: 404, TTL: time.Second}, {Status: 1000, TTL: -time.Second}},
+			CacheableMethods: []string{"GET", "FETCH"},
+			Compression:      []string{"gzip", "deflate"},
+			Keys: []Key{
+				{Type: "query"}, {Type: "path", Name: "x"}, {Type: "jwt"},
+				{Type: "query", Name: "a", Include: []string{"b"}}, {Type: "query_all", Exclude: []string{"utm_*", "[a"}},
+				{Type: "cookie"}, {Type: "host", TrustedProxies: []string{"10.0.0.1"}},
+				{Type: "remote_ip", TrustedProxies: []string{"10.0.0.0/8", "proxy"}},
+				{Type: "path", MaxSize: 10}, {Type: "graphql", MaxSize: -1},
+			},
+			Bypass: []Bypass{{Type: "header", Name: "X"}, {Type: "method", Name: "FETCH"}, {}},
+		},
+		StoreFailurePolicy: "retry",
+		Routes: []Route{
+			{Pattern: "users"},
+			{Store: "c"},
+			{Pattern: "/users", Policy: Policy{MaxBodySize: -1}},
+		},
+	}
+
+	assert.EqualError(t, cfg.Validate(), `config: store.path: is required for a filesystem store
+config: store.redis: is only supported by a redis store
+config: stores.a.type: unknown store type "memcached", expected one of memory, filesystem, redis
+config: stores.b.expiration: must not be negative
+config: stores.b.redis.addr: is required for a redis store
+config: stores.b.compression.codec: unknown codec "lz4", expected one of gzip, snappy, zstd
+config: stores.b.compression.threshold: must not be negative
+config: ttl: must not be negative
+config: cacheable_status[1]: invalid status code 42
+config: status_ttl[1].status: invalid status code 1000
+config: status_ttl[1].ttl: must not be negative
+config: compression[1]: unknown encoding "deflate", expected one of br, zstd, gzip
+config: cacheable_methods[1]: unknown method "FETCH"
+config: keys[0].name: is required for a query key
+config: keys[1].name: is not supported by a path key
+config: keys[2].type: unknown key type "jwt", expected one of path, method, query, query_all, header, cookie, host, scheme, remote_ip, body, json_body, graphql
+config: keys[3].include: is only supported by a query_all key
+config: keys[4].exclude[1]: invalid pattern "[a"
+config: keys[5].name: is required for a cookie key
+config: keys[6].trusted_proxies: is only supported by scheme and remote_ip keys
+config: keys[7].trusted_proxies[1]: invalid IP address or CIDR range "proxy"
+config: keys[8].max_size: is only supported by body, json_body and graphql keys
+config: keys[9].max_size: must not be negative
+config: bypass[0].value: is required for a header bypass
+config: bypass[1].name: unknown method "FETCH"
+config: bypass[2].type: is required, expected one of header, method
+config: store_failure_policy: unknown policy "retry", expected one of fail_open, fail_closed, circuit_break
+config: routes[0].pattern: route pattern "users" must start with a '/'
+config: routes[1].pattern: is required
+config: routes[1].store: unknown store "c"
+config: routes[2].max_body_size: must not be negative`)
+}
+
+func TestValidateMemoryStoreRequiresExpiration(t *testing.T) {
+	cfg := &Config{Store: StoreConfig{Type: "memory"}}
+	assert.EqualError(t, cfg.Validate(), "config: store.expiration: is required for a memory store")
+
+	cfg = &Config{Store: StoreConfig{Type: "redis", Redis: RedisConfig{Addr: "localhost:6379"}}}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateEmptyStoreName(t *testing.T) {
+	cfg := &Config{
+		Store:  StoreConfig{Type: "memory", Expiration: time.Minute},
+		Stores: map[string]StoreConfig{"": {Type: "memory", Expiration: time.Minute}},
+	}
+	assert.EqualError(t, cfg.Validate(), "config: stores: store name must not be empty")
+
+	_, err := Parse([]byte("store:\n  type: memory\n  expiration: 1m\nstores:\n  \"\":\n    type: memory\n    expiration: 1m\n"))
+	assert.EqualError(t, err, "config: stores: store name must not be empty")
+}
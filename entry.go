@@ -0,0 +1,74 @@
+package cache_handler
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http"
+	"time"
+)
+
+// entry is the envelope a response is stored in
+type entry struct {
+	Created time.Time
+	// Expires is zero if the expiration is unknown
+	Expires time.Time
+	Status  int
+	Header  http.Header
+	Body    []byte
+	// Uncacheable marks a response that exceeded the maximum body size,
+	// it is forwarded without recording until the entry expires
+	Uncacheable bool
+}
+
+// unstoredHeaders are not stored with a response, they belong to the connection,
+// are set by the cache or must not be shared between clients
+var unstoredHeaders = []string{
+	"Age", "Cache-Status", "Connection", "Keep-Alive", "Proxy-Connection",
+	"Set-Cookie", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// storedHeader returns a copy of the response header without unstored headers
+func storedHeader(header http.Header) http.Header {
+	stored := header.Clone()
+	for _, name := range unstoredHeaders {
+		stored.Del(name)
+	}
+
+	return stored
+}
+
+// encodeEntry serializes the entry for a store
+func encodeEntry(e entry) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(e); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeEntry deserializes an entry read from a store
+func decodeEntry(data []byte) (entry, error) {
+	e := entry{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e)
+	return e, err
+}
+
+// age returns the age of the entry at given time
+func (e entry) age(now time.Time) time.Duration {
+	if age := now.Sub(e.Created); age > 0 {
+		return age
+	}
+
+	return 0
+}
+
+// ttl returns the remaining freshness lifetime at given time and
+// if it is known at all
+func (e entry) ttl(now time.Time) (time.Duration, bool) {
+	if e.Expires.IsZero() {
+		return 0, false
+	}
+
+	return e.Expires.Sub(now), true
+}
@@ -0,0 +1,60 @@
+package cache_handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryEncoding(t *testing.T) {
+	created := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+	e := entry{
+		Created: created,
+		Expires: created.Add(time.Minute),
+		Header:  http.Header{"Content-Type": {"text/plain"}},
+		Body:    []byte("content"),
+	}
+
+	data, err := encodeEntry(e)
+	assert.NoError(t, err)
+	decoded, err := decodeEntry(data)
+	assert.NoError(t, err)
+	assert.True(t, e.Created.Equal(decoded.Created))
+	assert.True(t, e.Expires.Equal(decoded.Expires))
+	assert.Equal(t, e.Header, decoded.Header)
+	assert.Equal(t, e.Body, decoded.Body)
+
+	_, err = decodeEntry([]byte("not an entry"))
+	assert.Error(t, err)
+}
+
+func TestEntryAgeAndTTL(t *testing.T) {
+	created := time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC)
+	e := entry{Created: created}
+
+	assert.Equal(t, 5*time.Second, e.age(created.Add(5*time.Second)))
+	assert.Equal(t, time.Duration(0), e.age(created.Add(-5*time.Second)))
+
+	_, ok := e.ttl(created)
+	assert.False(t, ok)
+
+	e.Expires = created.Add(time.Minute)
+	ttl, ok := e.ttl(created.Add(15 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 45*time.Second, ttl)
+}
+
+func TestStoredHeader(t *testing.T) {
+	header := http.Header{
+		"Content-Type": {"application/json"},
+		"Etag":         {`"v1"`},
+		"Set-Cookie":   {"session=secret"},
+		"Cache-Status": {"cache_handler; fwd=miss"},
+		"Connection":   {"close"},
+	}
+
+	assert.Equal(t, http.Header{"Content-Type": {"application/json"}, "Etag": {`"v1"`}}, storedHeader(header))
+	assert.Len(t, header, 5, "header is not modified")
+}
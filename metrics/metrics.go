@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Sink receives metrics of the middleware and the stores
+type Sink interface {
+	// Count adds delta to the counter with given name
+	Count(name string, delta int64)
+	// Gauge sets the gauge with given name to value
+	Gauge(name string, value float64)
+	// Observe records a sample like a latency for the summary with given name
+	Observe(name string, value float64)
+}
+
+// discard ignores all metrics
+type discard struct{}
+
+func (discard) Count(name string, delta int64)     {}
+func (discard) Gauge(name string, value float64)   {}
+func (discard) Observe(name string, value float64) {}
+
+// Discard is a Sink that ignores all metrics
+var Discard Sink = discard{}
+
+// Summary of observed samples
+type Summary struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// Registry is a Sink that keeps metrics in memory.
+// It implements expvar.Var so it can be published with expvar.Publish.
+type Registry struct {
+	mutex     *sync.RWMutex
+	counters  map[string]int64
+	gauges    map[string]float64
+	summaries map[string]Summary
+}
+
+// NewRegistry create a new Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		mutex:     &sync.RWMutex{},
+		counters:  map[string]int64{},
+		gauges:    map[string]float64{},
+		summaries: map[string]Summary{},
+	}
+}
+
+// Count adds delta to the counter with given name
+func (registry *Registry) Count(name string, delta int64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.counters[name] += delta
+}
+
+// Gauge sets the gauge with given name to value
+func (registry *Registry) Gauge(name string, value float64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.gauges[name] = value
+}
+
+// Observe records a sample for the summary with given name
+func (registry *Registry) Observe(name string, value float64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	summary, ok := registry.summaries[name]
+	if !ok || value < summary.Min {
+		summary.Min = value
+	}
+	if !ok || value > summary.Max {
+		summary.Max = value
+	}
+	summary.Count++
+	summary.Sum += value
+	registry.summaries[name] = summary
+}
+
+// Counter returns the value of the counter with given name
+func (registry *Registry) Counter(name string) int64 {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	return registry.counters[name]
+}
+
+// GaugeValue returns the value of the gauge with given name
+func (registry *Registry) GaugeValue(name string) float64 {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	return registry.gauges[name]
+}
+
+// Summary returns the summary with given name
+func (registry *Registry) Summary(name string) Summary {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	return registry.summaries[name]
+}
+
+// String returns all metrics as JSON
+func (registry *Registry) String() string {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	data, _ := json.Marshal(struct {
+		Counters  map[string]int64   `json:"counters"`
+		Gauges    map[string]float64 `json:"gauges"`
+		Summaries map[string]Summary `json:"summaries"`
+	}{registry.counters, registry.gauges, registry.summaries})
+	return string(data)
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscard(t *testing.T) {
+	Discard.Count("counter", 1)
+	Discard.Gauge("gauge", 1)
+	Discard.Observe("summary", 1)
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Count("counter", 1)
+	registry.Count("counter", 2)
+	registry.Gauge("gauge", 1)
+	registry.Gauge("gauge", 0.5)
+	registry.Observe("summary", 2)
+	registry.Observe("summary", 1)
+	registry.Observe("summary", 3)
+
+	assert.Equal(t, int64(3), registry.Counter("counter"))
+	assert.Equal(t, int64(0), registry.Counter("not_exists"))
+	assert.Equal(t, 0.5, registry.GaugeValue("gauge"))
+	assert.Equal(t, Summary{Count: 3, Sum: 6, Min: 1, Max: 3}, registry.Summary("summary"))
+
+	var _ expvar.Var = registry
+	exported := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(registry.String()), &exported))
+	assert.Equal(t, map[string]interface{}{"counter": 3.0}, exported["counters"])
+}
@@ -1,28 +1,403 @@
 package cache_handler
 
 import (
+	"bytes"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/StevenCyb/cache_handler/store"
 )
 
-func NewMiddleware(next http.HandlerFunc, store store.Store, opts ...Options) http.HandlerFunc {
-	cm := cacheManager{
-		Store:             store,
-		IncludeKeyOptions: []Options{UsePathKey{}},
-	}
-	cm.useOptions(opts...)
+// NewMiddleware creates a handler func that serves responses of next from the cache
+func NewMiddleware(next http.HandlerFunc, store store.Store, opts ...Option) http.HandlerFunc {
+	cm := newCacheManager(store, opts...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		key := cm.keyFromRequest(r)
-		cachedData, err := cm.Store.Get(key)
-
-		if cm.canBypass(r) || err != nil {
-			rec := NewHttpRecorder(w)
-			next.ServeHTTP(rec, r)
-			cm.Store.Set(key, rec.Body.Bytes())
-		} else {
-			w.Write(cachedData)
+		cm.route(r).serve(next, w, r)
+	}
+}
+
+// Middleware creates a middleware that serves responses of the next handler from the cache.
+// It fits routers that chain `func(http.Handler) http.Handler` like chi or gorilla/mux.
+func Middleware(store store.Store, opts ...Option) func(http.Handler) http.Handler {
+	cm := newCacheManager(store, opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cm.route(r).serve(next, w, r)
+		})
+	}
+}
+
+// serve the request from the cache or forward it to next
+func (cm cacheManager) serve(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if cm.Disabled {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if !cm.isCacheableMethod(r.Method) {
+		cm.Logger.Debug("bypassing cache, method not cacheable",
+			slog.String("method", r.Method), slog.String("path", r.URL.Path))
+		cm.Metrics.Count("cache.bypasses", 1)
+		cm.forward(next, w, r, "", cacheStatusBypass, false)
+		return
+	}
+
+	// HEAD requests are answered from the GET response and never populate the cache
+	keyRequest, save := r, r.Method != http.MethodHead
+	if !save {
+		keyRequest = r.WithContext(r.Context())
+		keyRequest.Method = http.MethodGet
+	}
+	key, err := cm.keyFromRequest(keyRequest)
+	r.Body = keyRequest.Body
+	if err != nil {
+		level := slog.LevelWarn
+		if errors.Is(err, ErrGraphQLMutation) {
+			level = slog.LevelDebug
+		}
+		cm.Logger.Log(r.Context(), level, "bypassing cache, failed to build key",
+			slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.Any("error", err))
+		cm.Metrics.Count("cache.bypasses", 1)
+		cm.forward(next, w, r, "", cacheStatusBypass, false)
+		return
+	}
+
+	// a shared entry must not be served to or populated by a request with credentials
+	if credential := cm.unkeyedCredential(r); credential != "" {
+		cm.Logger.Warn("bypassing cache, the key doesn't include the credentials of the request",
+			slog.String("key", key), slog.String("header", credential),
+			slog.String("method", r.Method), slog.String("path", r.URL.Path))
+		cm.Metrics.Count("cache.bypasses", 1)
+		cm.forward(next, w, r, key, cacheStatusBypass, false)
+		return
+	}
+
+	if cm.canBypass(r) {
+		cm.Logger.Debug("bypassing cache",
+			slog.String("key", key), slog.String("method", r.Method), slog.String("path", r.URL.Path))
+		cm.Metrics.Count("cache.bypasses", 1)
+		cm.forward(next, w, r, key, cacheStatusBypass, save)
+		return
+	}
+
+	cachedData, result := cm.lookup(key)
+	switch result {
+	case lookupMiss:
+		cm.Metrics.Count("cache.misses", 1)
+		cm.forward(next, w, r, key, cacheStatusMiss, save)
+		return
+	case lookupExpired:
+		cm.Metrics.Count("cache.stale", 1)
+		cm.forward(next, w, r, key, cacheStatusStale, save)
+		return
+	case lookupSkipped:
+		cm.Metrics.Count("cache.store_unavailable", 1)
+		cm.forward(next, w, r, key, cacheStatusUnavailable, false)
+		return
+	case lookupFailed:
+		cm.Metrics.Count("cache.store_unavailable", 1)
+		if cm.FailurePolicy == FailClosed {
+			cm.setCacheStatus(w, cacheStatusUnavailable, key, 0, false)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		cm.forward(next, w, r, key, cacheStatusUnavailable, false)
+		return
+	}
+
+	cached, err := decodeEntry(cachedData)
+	if err != nil {
+		cm.Logger.Warn("corrupt cache entry",
+			slog.String("key", key), slog.Any("error", err))
+		cm.Metrics.Count("cache.misses", 1)
+		cm.forward(next, w, r, key, cacheStatusMiss, save)
+		return
+	}
+
+	if cached.Uncacheable {
+		cm.Logger.Debug("bypassing cache, response exceeded the maximum body size", slog.String("key", key))
+		cm.Metrics.Count("cache.bypasses", 1)
+		cm.forward(next, w, r, key, cacheStatusUncacheable, false)
+		return
+	}
+
+	cm.Logger.Debug("serving cached response", slog.String("key", key))
+	cm.Metrics.Count("cache.hits", 1)
+	cm.serveCached(w, r, key, cached)
+}
+
+// serveCached writes the cached response, compressed if compression is enabled
+func (cm cacheManager) serveCached(w http.ResponseWriter, r *http.Request, key string, cached entry) {
+	now := cm.Clock.Now()
+	ttl, ttlKnown := cached.ttl(now)
+	for name, values := range cached.Header {
+		w.Header()[name] = values
+	}
+	cm.setCacheStatus(w, cacheStatusHit, key, ttl, ttlKnown)
+	cm.setAge(w, cached.age(now))
+	cm.writeEntry(w, r, key, cached)
+}
+
+// writeEntry writes the status and body of the entry, compressed if compression is enabled,
+// the header of the response must be set already
+func (cm cacheManager) writeEntry(w http.ResponseWriter, r *http.Request, key string, cached entry) {
+	status := cached.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := cached.Body
+	if len(cm.Encodings) > 0 {
+		addVary(w.Header(), "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), cm.Encodings)
+		if encoding != "" && len(body) > 0 && isCompressible(status, w.Header()) {
+			compressed, err := cm.compressedVariant(key, cached, encoding)
+			if err != nil {
+				cm.Logger.Error("failed to compress response",
+					slog.String("key", key), slog.String("encoding", string(encoding)), slog.Any("error", err))
+			} else {
+				setEncodingHeaders(w.Header(), encoding)
+				body = compressed
+			}
+		}
+	}
+
+	if r.Header.Get("Range") != "" && status == http.StatusOK {
+		serveRange(w, r, body)
+		return
+	}
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// serveRange answers a range request from the complete cached response body,
+// If-Range is checked against the ETag and Last-Modified response headers
+func serveRange(w http.ResponseWriter, r *http.Request, body []byte) {
+	modified, err := http.ParseTime(w.Header().Get("Last-Modified"))
+	if err != nil {
+		modified = time.Time{}
+	}
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+// forward the request to the next handler and store the recorded response if requested
+func (cm cacheManager) forward(next http.Handler, w http.ResponseWriter, r *http.Request, key, cacheStatus string, save bool) {
+	cm.setCacheStatus(w, cacheStatus, key, 0, false)
+	if !save {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if r.Header.Get("Range") != "" {
+		cm.forwardRange(next, w, r, key)
+		return
+	}
+
+	// with compression the handler responds uncompressed and the response is compressed here
+	var cw *compressWriter
+	if len(cm.Encodings) > 0 {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), cm.Encodings)
+		cw, w = newCompressWriter(w, encoding)
+		r = r.WithContext(r.Context())
+		r.Header = r.Header.Clone()
+		r.Header.Del("Accept-Encoding")
+	}
+
+	rec := NewHttpRecorder(w)
+	rec.MaxSize = cm.MaxBodySize
+	next.ServeHTTP(rec.Writer(), r)
+
+	header := rec.Header()
+	if cw != nil {
+		if err := cw.Close(); err != nil {
+			cm.Logger.Warn("failed to complete compressed response",
+				slog.String("key", key), slog.Any("error", err))
 		}
+		header = cw.uncompressedHeader()
+	}
+
+	cm.record(key, rec, header)
+}
+
+// forwardRange forwards a range request without its range, so the complete response
+// is cached, and answers the range from it. The response is buffered up to the
+// maximum body size, if it exceeds it the complete response is sent through.
+func (cm cacheManager) forwardRange(next http.Handler, w http.ResponseWriter, r *http.Request, key string) {
+	forwarded := r.WithContext(r.Context())
+	forwarded.Header = r.Header.Clone()
+	forwarded.Header.Del("Range")
+	forwarded.Header.Del("If-Range")
+	buffered := &bufferWriter{w: w, header: http.Header{}, maxSize: cm.MaxBodySize}
+	if len(cm.Encodings) > 0 {
+		forwarded.Header.Del("Accept-Encoding")
+		buffered.vary = "Accept-Encoding"
+	}
+
+	next.ServeHTTP(buffered, forwarded)
+
+	rec := &HttpRecorder{Body: &buffered.body, Status: buffered.status, Exceeded: buffered.sent}
+	if buffered.sent {
+		cm.record(key, rec, w.Header())
+		return
+	}
+	for name, values := range buffered.header {
+		w.Header()[name] = values
+	}
+	if cached, ok := cm.record(key, rec, buffered.header); ok {
+		cm.writeEntry(w, r, key, cached)
+		return
+	}
+
+	// the response is not cacheable, the range is answered from the buffered response
+	if buffered.vary != "" {
+		addVary(w.Header(), buffered.vary)
+	}
+	status := buffered.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status == http.StatusOK {
+		serveRange(w, r, buffered.body.Bytes())
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(buffered.body.Bytes())
+}
+
+// record stores the response recorded by rec with given header if it is cacheable,
+// it returns the entry and if the response is cacheable
+func (cm cacheManager) record(key string, rec *HttpRecorder, header http.Header) (entry, bool) {
+	status := rec.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if rec.Flushed || rec.Hijacked {
+		cm.Logger.Debug("response not cacheable, it was streamed or hijacked", slog.String("key", key))
+		cm.Metrics.Count("cache.uncacheable", 1)
+		return entry{}, false
+	}
+	if rec.Exceeded {
+		cm.Logger.Debug("response exceeded the maximum body size",
+			slog.String("key", key), slog.Int("max_size", cm.MaxBodySize))
+		cm.Metrics.Count("cache.uncacheable", 1)
+		cm.markUncacheable(key)
+		return entry{}, false
+	}
+	if !cm.isCacheable(status, rec.Body.Len()) {
+		cm.Logger.Debug("response not cacheable",
+			slog.String("key", key), slog.Int("status", status), slog.Int("size", rec.Body.Len()))
+		cm.Metrics.Count("cache.uncacheable", 1)
+		return entry{}, false
+	}
+	if reason := cm.privateReason(header); reason != "" {
+		cm.Logger.Debug("response not cacheable, "+reason, slog.String("key", key))
+		cm.Metrics.Count("cache.uncacheable", 1)
+		return entry{}, false
+	}
+
+	e := cm.newEntry(status, header, rec.Body.Bytes())
+	data, err := encodeEntry(e)
+	if err != nil {
+		cm.Logger.Error("failed to encode response",
+			slog.String("key", key), slog.Any("error", err))
+		return e, true
+	}
+	cm.saveWithTTL(key, data, cm.statusTTL(status))
+
+	return e, true
+}
+
+// bufferWriter buffers a response instead of sending it to w.
+// Like net/http the content type is detected if not set.
+// If the body exceeds maxSize the buffered response is sent
+// and the rest of the body is written through.
+type bufferWriter struct {
+	w       http.ResponseWriter
+	header  http.Header
+	status  int
+	body    bytes.Buffer
+	maxSize int
+	vary    string
+	sent    bool
+}
+
+// Header returns the header of the buffered response
+func (bw *bufferWriter) Header() http.Header {
+	if bw.sent {
+		return bw.w.Header()
+	}
+	return bw.header
+}
+
+// WriteHeader records the first final status code
+func (bw *bufferWriter) WriteHeader(status int) {
+	if bw.status == 0 && status >= http.StatusOK {
+		bw.status = status
+	}
+}
+
+// Write buffers the data, or writes it through once the body exceeds maxSize
+func (bw *bufferWriter) Write(data []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	if bw.sent {
+		return bw.w.Write(data)
+	}
+	if _, ok := bw.header["Content-Type"]; !ok && bw.body.Len() == 0 && len(data) > 0 {
+		bw.header.Set("Content-Type", http.DetectContentType(data))
+	}
+	if bw.maxSize > 0 && bw.body.Len()+len(data) > bw.maxSize {
+		if err := bw.send(); err != nil {
+			return 0, err
+		}
+		return bw.w.Write(data)
+	}
+
+	return bw.body.Write(data)
+}
+
+// send sends the buffered response to w and discards the buffered body
+func (bw *bufferWriter) send() error {
+	bw.sent = true
+	for name, values := range bw.header {
+		bw.w.Header()[name] = values
+	}
+	if bw.vary != "" {
+		addVary(bw.w.Header(), bw.vary)
+	}
+	bw.w.WriteHeader(bw.status)
+	_, err := bw.w.Write(bw.body.Bytes())
+	bw.body = bytes.Buffer{}
+
+	return err
+}
+
+// markUncacheable stores an entry that lets requests for the key bypass
+// the cache without recording the response until it expires
+func (cm cacheManager) markUncacheable(key string) {
+	ttl := cm.UncacheableTTL
+	if ttl <= 0 {
+		ttl = cm.ttl()
+	}
+
+	e := entry{Created: cm.Clock.Now(), Uncacheable: true}
+	if ttl > 0 {
+		e.Expires = e.Created.Add(ttl)
+	}
+	data, err := encodeEntry(e)
+	if err != nil {
+		cm.Logger.Error("failed to encode entry",
+			slog.String("key", key), slog.Any("error", err))
+		return
 	}
+	cm.saveWithTTL(key, data, ttl)
 }
@@ -1,13 +1,19 @@
 package cache_handler
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
+	"github.com/StevenCyb/cache_handler/metrics"
 	"github.com/StevenCyb/cache_handler/store"
 
 	"github.com/stretchr/testify/assert"
@@ -16,12 +22,16 @@ import (
 func TestMiddleware(t *testing.T) {
 	middlewareTestCounter := 0
 
-	store := store.NewInMemoryStore(time.Second * 2)
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	store := store.NewInMemoryStore(time.Second*2, store.WithClock(clock))
+	defer store.Close()
 	testMiddlewareHandler := NewMiddleware(
 		func(w http.ResponseWriter, r *http.Request) {
 			middlewareTestCounter++
 			w.Write([]byte(strconv.Itoa(middlewareTestCounter)))
 		}, store,
+		WithClock(clock),
+		WithCacheableMethods("GET", "POST"),
 		UseMethodKey{},
 		UseHeaderKey{Key: "Authorization"},
 		UseQueryParamsKey{Key: "name"},
@@ -30,7 +40,7 @@ func TestMiddleware(t *testing.T) {
 	request(t, &testMiddlewareHandler, "GET", "/", http.Header{}, 1)
 	request(t, &testMiddlewareHandler, "GET", "/", http.Header{}, 1)
 
-	time.Sleep(time.Second * 3)
+	clock.Advance(time.Second * 3)
 	request(t, &testMiddlewareHandler, "GET", "/", http.Header{}, 2)
 	request(t, &testMiddlewareHandler, "GET", "/", http.Header{}, 2)
 	request(t, &testMiddlewareHandler, "POST", "/", http.Header{}, 3)
@@ -50,7 +60,7 @@ func TestMiddleware(t *testing.T) {
 	request(t, &testMiddlewareHandler, "POST", "/a?name=mike", h, 8)
 	request(t, &testMiddlewareHandler, "POST", "/a?name=mike", h, 8)
 
-	time.Sleep(time.Second * 3)
+	clock.Advance(time.Second * 3)
 	request(t, &testMiddlewareHandler, "GET", "/", http.Header{}, 9)
 	request(t, &testMiddlewareHandler, "POST", "/", http.Header{}, 10)
 	request(t, &testMiddlewareHandler, "POST", "/a", http.Header{}, 11)
@@ -74,3 +84,510 @@ func request(t *testing.T, testMiddlewareHandler *http.HandlerFunc, method, path
 	testMiddlewareHandler.ServeHTTP(hr, req)
 	assert.Equal(t, strconv.Itoa(expectedCounter), hr.Body.String(), errorDetails)
 }
+
+type failingStore struct {
+	getErr, setErr error
+	gets, sets     int
+}
+
+func (s *failingStore) Get(key string) ([]byte, error) {
+	s.gets++
+	return nil, s.getErr
+}
+
+func (s *failingStore) Set(key string, data []byte) error {
+	s.sets++
+	return s.setErr
+}
+
+func (s *failingStore) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	return s.Set(key, data)
+}
+
+func (s *failingStore) Expiration() time.Duration { return time.Minute }
+
+func (s *failingStore) Close() error { return nil }
+
+func TestMiddlewareLogsStoreFailure(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	testMiddlewareHandler := NewMiddleware(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("1"))
+		}, &failingStore{getErr: store.ErrNotFound, setErr: errors.New("connection refused")},
+		AllowBypassHeader{Key: "Cache-Status", Value: "bypass"},
+		WithLogger(logger),
+	)
+
+	request(t, &testMiddlewareHandler, "GET", "/", http.Header{}, 1)
+	assert.Contains(t, logs.String(), "level=ERROR msg=\"failed to store response\"")
+	assert.Contains(t, logs.String(), "error=\"connection refused\"")
+
+	logs.Reset()
+	h := http.Header{}
+	h.Add("Cache-Status", "bypass")
+	request(t, &testMiddlewareHandler, "GET", "/", h, 1)
+	assert.Contains(t, logs.String(), "level=DEBUG msg=\"bypassing cache\"")
+}
+
+func TestMiddlewareCacheStatusAndAgeHeader(t *testing.T) {
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	testMiddlewareHandler := NewMiddleware(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("1"))
+		}, store.NewInMemoryStore(time.Minute, store.WithClock(clock)),
+		WithClock(clock),
+		AllowBypassHeader{Key: "Cache-Control", Value: "no-cache"},
+		WithCacheStatusHeader("", false),
+		WithAgeHeader(),
+	)
+
+	w := httptest.NewRecorder()
+	testMiddlewareHandler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "cache_handler; fwd=miss", w.Header().Get("Cache-Status"))
+	assert.Empty(t, w.Header().Get("Age"))
+
+	clock.Advance(15 * time.Second)
+	w = httptest.NewRecorder()
+	testMiddlewareHandler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "cache_handler; hit; ttl=45", w.Header().Get("Cache-Status"))
+	assert.Equal(t, "15", w.Header().Get("Age"))
+	assert.Equal(t, "1", w.Body.String())
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cache-Control", "no-cache")
+	testMiddlewareHandler.ServeHTTP(w, r)
+	assert.Equal(t, "cache_handler; fwd=bypass", w.Header().Get("Cache-Status"))
+}
+
+func TestMiddlewareStoreFailurePolicy(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1"))
+	}
+	connectionErr := errors.New("connection refused")
+
+	failing := &failingStore{getErr: connectionErr, setErr: connectionErr}
+	failOpen := NewMiddleware(handler, failing, WithCacheStatusHeader("", false))
+	w := httptest.NewRecorder()
+	failOpen.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Body.String())
+	assert.Equal(t, "cache_handler; fwd=bypass; detail=store-unavailable", w.Header().Get("Cache-Status"))
+	assert.Equal(t, 0, failing.sets)
+
+	failing = &failingStore{getErr: connectionErr, setErr: connectionErr}
+	failClosed := NewMiddleware(handler, failing, WithStoreFailurePolicy(FailClosed))
+	w = httptest.NewRecorder()
+	failClosed.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEqual(t, "1", w.Body.String())
+
+	failing = &failingStore{getErr: connectionErr, setErr: connectionErr}
+	circuitBreak := NewMiddleware(handler, failing,
+		WithCircuitBreaker(2, time.Minute))
+	for i := 0; i < 5; i++ {
+		w = httptest.NewRecorder()
+		circuitBreak.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, "1", w.Body.String())
+	}
+	assert.Equal(t, 2, failing.gets)
+	assert.Equal(t, 0, failing.sets)
+}
+
+func TestMiddlewareStaleCacheStatus(t *testing.T) {
+	testMiddlewareHandler := NewMiddleware(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("1"))
+		}, &failingStore{getErr: store.ErrExpired},
+		WithCacheStatusHeader("", false),
+	)
+
+	w := httptest.NewRecorder()
+	testMiddlewareHandler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "cache_handler; fwd=stale", w.Header().Get("Cache-Status"))
+}
+
+type bypassAdmin struct{}
+
+func (bypassAdmin) Bypass(r *http.Request) bool { return r.Header.Get("X-Role") == "admin" }
+
+func TestMiddlewareSettings(t *testing.T) {
+	counter := 0
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	registry := metrics.NewRegistry()
+	testMiddlewareHandler := NewMiddleware(
+		func(w http.ResponseWriter, r *http.Request) {
+			counter++
+			switch r.URL.Path {
+			case "/missing":
+				w.WriteHeader(http.StatusNotFound)
+			case "/error":
+				w.WriteHeader(http.StatusInternalServerError)
+			case "/large":
+				w.Write([]byte("large body"))
+				return
+			}
+			w.Write([]byte(strconv.Itoa(counter)))
+		}, store.NewInMemoryStore(time.Minute, store.WithClock(clock)),
+		WithClock(clock),
+		WithTTL(time.Hour),
+		WithMaxBodySize(4),
+		WithCacheableStatus(http.StatusOK, http.StatusNotFound),
+		WithBypassRule(bypassAdmin{}),
+		WithMetrics(registry),
+	)
+
+	serve := func(path string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header = header
+		testMiddlewareHandler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, "1", serve("/", http.Header{}).Body.String())
+	clock.Advance(30 * time.Minute)
+	assert.Equal(t, "1", serve("/", http.Header{}).Body.String())
+	assert.Equal(t, "2", serve("/", http.Header{"X-Role": {"admin"}}).Body.String())
+
+	w := serve("/missing", http.Header{})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "3", w.Body.String())
+	w = serve("/missing", http.Header{})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "3", w.Body.String())
+
+	assert.Equal(t, "4", serve("/error", http.Header{}).Body.String())
+	assert.Equal(t, "5", serve("/error", http.Header{}).Body.String())
+	assert.Equal(t, "large body", serve("/large", http.Header{}).Body.String())
+	assert.Equal(t, "large body", serve("/large", http.Header{}).Body.String())
+	assert.Equal(t, 7, counter)
+
+	assert.Equal(t, int64(2), registry.Counter("cache.hits"))
+	assert.Equal(t, int64(5), registry.Counter("cache.misses"))
+	assert.Equal(t, int64(2), registry.Counter("cache.bypasses"))
+	assert.Equal(t, int64(3), registry.Counter("cache.uncacheable"))
+	assert.Equal(t, int64(4), registry.Counter("cache.stored"))
+}
+
+func TestMiddlewareHandler(t *testing.T) {
+	calls := 0
+	store := store.NewInMemoryStore(time.Minute)
+	defer store.Close()
+	handler := Middleware(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(strconv.Itoa(calls)))
+	}))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/a", nil))
+		assert.Equal(t, "1", rec.Body.String())
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/b", nil))
+	assert.Equal(t, "2", rec.Body.String())
+}
+
+func TestMiddlewareMaxBodySize(t *testing.T) {
+	calls := 0
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	s := store.NewInMemoryStore(time.Hour, store.WithClock(clock))
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("chunk"))
+		}
+	}, s,
+		WithClock(clock),
+		WithMaxBodySize(12),
+		WithUncacheableTTL(time.Minute),
+		WithCacheStatusHeader("", false),
+	)
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/download", nil))
+		return w
+	}
+
+	w := serve()
+	assert.Equal(t, "chunkchunkchunkchunk", w.Body.String())
+	assert.Equal(t, "cache_handler; fwd=miss", w.Header().Get("Cache-Status"))
+
+	w = serve()
+	assert.Equal(t, "chunkchunkchunkchunk", w.Body.String())
+	assert.Equal(t, "cache_handler; fwd=bypass; detail=uncacheable", w.Header().Get("Cache-Status"))
+	assert.Equal(t, 2, calls)
+
+	clock.Advance(2 * time.Minute)
+	w = serve()
+	assert.Equal(t, "chunkchunkchunkchunk", w.Body.String())
+	assert.Equal(t, "cache_handler; fwd=stale", w.Header().Get("Cache-Status"))
+	assert.Equal(t, 3, calls)
+}
+
+func TestMiddlewareStreamedResponse(t *testing.T) {
+	calls := 0
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("event"))
+		if r.URL.Path == "/events" {
+			http.NewResponseController(w).Flush()
+		}
+	}, s)
+
+	for i := 1; i <= 2; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/events", nil))
+		assert.Equal(t, "event", w.Body.String())
+		assert.True(t, w.Flushed)
+		assert.Equal(t, i, calls)
+	}
+
+	// the writer only supports flushing through Unwrap
+	for i := 3; i <= 4; i++ {
+		w := httptest.NewRecorder()
+		handler(unwrappingWriter{w}, httptest.NewRequest("GET", "/events", nil))
+		assert.True(t, w.Flushed)
+		assert.Equal(t, i, calls)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/static", nil))
+	handler(w, httptest.NewRequest("GET", "/static", nil))
+	assert.Equal(t, 5, calls)
+}
+
+func TestMiddlewareCacheableStatusAndMethods(t *testing.T) {
+	calls := 0
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	s := store.NewInMemoryStore(time.Hour, store.WithClock(clock))
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(strconv.Itoa(calls)))
+	}, s, WithClock(clock), WithStatusTTL(http.StatusNotFound, 30*time.Second))
+
+	serve := func(method, path string) string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, path, nil))
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "1", serve("GET", "/fail"))
+	assert.Equal(t, "2", serve("GET", "/fail"))
+	assert.Equal(t, "3", serve("POST", "/users"))
+	assert.Equal(t, "4", serve("POST", "/users"))
+	assert.Equal(t, "5", serve("GET", "/users"))
+	assert.Equal(t, "5", serve("GET", "/users"))
+
+	assert.Equal(t, "6", serve("GET", "/missing"))
+	assert.Equal(t, "6", serve("GET", "/missing"))
+	clock.Advance(time.Minute)
+	assert.Equal(t, "7", serve("GET", "/missing"))
+	assert.Equal(t, "5", serve("GET", "/users"))
+}
+
+func TestMiddlewareHead(t *testing.T) {
+	calls := 0
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	s := store.NewInMemoryStore(time.Hour, store.WithClock(clock))
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Set-Cookie", "session=secret")
+		if r.Method != http.MethodHead {
+			w.Write([]byte("content"))
+		}
+	}, s, WithClock(clock), UseMethodKey{}, WithCacheStatusHeader("", false), WithAllowSetCookie())
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "/users", nil))
+		return w
+	}
+
+	w := serve("HEAD")
+	assert.Equal(t, "cache_handler; fwd=miss", w.Header().Get("Cache-Status"))
+	w = serve("HEAD")
+	assert.Equal(t, "cache_handler; fwd=miss", w.Header().Get("Cache-Status"), "HEAD doesn't populate the cache")
+	assert.Equal(t, 2, calls)
+
+	w = serve("GET")
+	assert.Equal(t, "content", w.Body.String())
+	assert.Equal(t, 3, calls)
+
+	w = serve("HEAD")
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, "7", w.Header().Get("Content-Length"))
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+	assert.Equal(t, "cache_handler; hit; ttl=3600", w.Header().Get("Cache-Status"))
+
+	w = serve("GET")
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, "content", w.Body.String())
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Equal(t, []string{"cache_handler; hit; ttl=3600"}, w.Header().Values("Cache-Status"))
+}
+
+func TestMiddlewareRange(t *testing.T) {
+	calls := 0
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/partial" {
+			w.Header().Set("Content-Range", "bytes 0-1/10")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("01"))
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("0123456789"))
+	}, s, WithStatusTTL(http.StatusPartialContent, time.Minute), WithCacheStatusHeader("", false))
+
+	serve := func(path string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header = header
+		handler(w, r)
+		return w
+	}
+
+	w := serve("/partial", http.Header{"Range": {"bytes=0-1"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "01", w.Body.String())
+	assert.Equal(t, "bytes 0-1/10", w.Header().Get("Content-Range"))
+	serve("/partial", http.Header{"Range": {"bytes=0-1"}})
+	assert.Equal(t, 2, calls, "partial responses are not cached")
+
+	// the miss is forwarded without the range, cached and answered with the range
+	w = serve("/video", http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"v1"`}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "01", w.Body.String())
+	assert.Equal(t, "bytes 0-1/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "cache_handler; fwd=miss", w.Header().Get("Cache-Status"))
+	assert.Equal(t, 3, calls)
+
+	w = serve("/video", http.Header{"Range": {"bytes=2-4"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "234", w.Body.String())
+	assert.Equal(t, "bytes 2-4/10", w.Header().Get("Content-Range"))
+	assert.Contains(t, w.Header().Get("Cache-Status"), "hit")
+
+	w = serve("/video", http.Header{})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+
+	w = serve("/video", http.Header{"Range": {"bytes=0-1,8-"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "multipart/byteranges")
+	assert.Contains(t, w.Body.String(), "Content-Range: bytes 0-1/10\r\nContent-Type: text/plain\r\n\r\n01\r\n")
+	assert.Contains(t, w.Body.String(), "Content-Range: bytes 8-9/10\r\nContent-Type: text/plain\r\n\r\n89\r\n")
+
+	w = serve("/video", http.Header{"Range": {"bytes=7-"}, "If-Range": {`"v1"`}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "789", w.Body.String())
+
+	w = serve("/video", http.Header{"Range": {"bytes=7-"}, "If-Range": {`"v0"`}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+
+	w = serve("/video", http.Header{"Range": {"bytes=20-"}})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, 3, calls)
+}
+
+func TestMiddlewareRangeUncacheable(t *testing.T) {
+	calls := 0
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Empty(t, r.Header.Get("Range"))
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Set-Cookie", "session=secret")
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte("0123456789"))
+	}, s)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Range", "bytes=0-1")
+		handler(w, r)
+		return w
+	}
+
+	for i := 1; i <= 2; i++ {
+		w := serve("/login")
+		assert.Equal(t, http.StatusPartialContent, w.Code, "the range is answered from the uncacheable response")
+		assert.Equal(t, "01", w.Body.String())
+		assert.Equal(t, "bytes 0-1/10", w.Header().Get("Content-Range"))
+		assert.Equal(t, "session=secret", w.Header().Get("Set-Cookie"))
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, i, calls)
+	}
+
+	w := serve("/error")
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "ranges only apply to 200 responses")
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, 3, calls)
+}
+
+func TestMiddlewareRangeMaxBodySize(t *testing.T) {
+	calls := 0
+	body := strings.Repeat("0123456789", 1024)
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	var w *httptest.ResponseRecorder
+	handler := NewMiddleware(func(rw http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Range") != "" {
+			http.ServeContent(rw, r, "", time.Time{}, strings.NewReader(body))
+			return
+		}
+		for i := 0; i < len(body); i += 512 {
+			rw.Write([]byte(body[i : i+512]))
+		}
+		assert.Greater(t, w.Body.Len(), 0, "the response is sent once it exceeds the maximum body size")
+	}, s, WithMaxBodySize(1024))
+
+	serve := func() {
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/video", nil)
+		r.Header.Set("Range", "bytes=0-1")
+		handler(w, r)
+	}
+
+	serve()
+	assert.Equal(t, http.StatusOK, w.Code, "the complete response is sent")
+	assert.Equal(t, body, w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+	// the key is marked uncacheable, so the range is forwarded to the handler
+	serve()
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "01", w.Body.String())
+	assert.Equal(t, 2, calls)
+}
@@ -1,96 +1,318 @@
 package cache_handler
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"slices"
 	"strings"
 )
 
-// Options represent a option for the middleware
-type Options interface {
-	ExtractString(r *http.Request) string
-	ExtractBool(r *http.Request) bool
+// Option configures the middleware.
+// Key parts and bypass rules of this package are options themselves,
+// custom implementations are added with WithKeyPart and WithBypassRule.
+type Option interface {
+	apply(cm *cacheManager)
+}
+
+// KeyPart extracts a part of the cache key from a request.
+// If an error is returned the request bypasses the cache.
+type KeyPart interface {
+	KeyPart(r *http.Request) (string, error)
+}
+
+// BypassRule decides if a request bypasses the cache
+type BypassRule interface {
+	Bypass(r *http.Request) bool
 }
 
 // UsePathKey tells the cache to use path as part of the key
 type UsePathKey struct{}
 
-// ExtractString key from request and return the string
-func (opt UsePathKey) ExtractString(r *http.Request) string {
-	return r.URL.Path
+// KeyPart extract key from request and return the string
+func (opt UsePathKey) KeyPart(r *http.Request) (string, error) {
+	return r.URL.Path, nil
 }
 
-// ExtractBool does nothing but return false
-// (function required to match the interface)
-func (opt UsePathKey) ExtractBool(r *http.Request) bool { return false }
+func (opt UsePathKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
 
 // UseMethodKey tells the cache to use the http method as part of the key
 type UseMethodKey struct{}
 
-// ExtractString key from request and return the string
-func (opt UseMethodKey) ExtractString(r *http.Request) string {
-	return r.Method
+// KeyPart extract key from request and return the string
+func (opt UseMethodKey) KeyPart(r *http.Request) (string, error) {
+	return r.Method, nil
 }
 
-// ExtractBool does nothing but return false
-// (function required to match the interface)
-func (opt UseMethodKey) ExtractBool(r *http.Request) bool { return false }
+func (opt UseMethodKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
 
 // UseQueryParamsKey tells the cache to use query parameter value for given key
-// as part of the key
+// as part of the key. Values are encoded like a query string,
+// so multiple values can't collide with a single value.
 type UseQueryParamsKey struct{ Key string }
 
-// ExtractString key from request and return the string
-func (opt UseQueryParamsKey) ExtractString(r *http.Request) string {
-	params := r.URL.Query()[opt.Key]
-	return strings.Join(params, "/")
+// KeyPart extract key from request and return the string
+func (opt UseQueryParamsKey) KeyPart(r *http.Request) (string, error) {
+	params, ok := r.URL.Query()[opt.Key]
+	if !ok {
+		return "", nil
+	}
+	return url.Values{opt.Key: params}.Encode(), nil
+}
+
+func (opt UseQueryParamsKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
+
+// UseQueryKey tells the cache to use the normalized query as part of the key.
+// Parameters are sorted by name, values are decoded, deduplicated and encoded again,
+// so `?b=2&a=1` and `?a=%31&b=2&a=1` share the key.
+// Include and Exclude take parameter names or path.Match globs like `utm_*`,
+// if Include is empty all parameters that are not excluded are used.
+// A query that can't be decoded returns an error, so the request bypasses the cache.
+type UseQueryKey struct {
+	Include []string
+	Exclude []string
+}
+
+// KeyPart extract key from request and return the string
+func (opt UseQueryKey) KeyPart(r *http.Request) (string, error) {
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return "", err
+	}
+
+	for name, values := range query {
+		if (len(opt.Include) > 0 && !matchesAny(opt.Include, name)) || matchesAny(opt.Exclude, name) {
+			delete(query, name)
+			continue
+		}
+		query[name] = dedupe(values)
+	}
+
+	return query.Encode(), nil
 }
 
-// ExtractBool does nothing but return false
-// (function required to match the interface)
-func (opt UseQueryParamsKey) ExtractBool(r *http.Request) bool { return false }
+func (opt UseQueryKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
+
+// matchesAny returns if name equals or matches any of the patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == name {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
 
-// UseQueryParamsKey tells the cache to........
+// dedupe removes repeated values and keeps the order of the first occurrences
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := values[:0]
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+// UseHeaderKey tells the cache to use header value for given key
+// as part of the key. Values are escaped and joined with `,`
+// after their count, so multiple values can't collide with a single value
+// and a missing header can't collide with an empty one.
 type UseHeaderKey struct{ Key string }
 
-// ExtractString key from request and return the string
-func (opt UseHeaderKey) ExtractString(r *http.Request) string {
-	params := r.Header[opt.Key]
-	return strings.Join(params, "/")
+// KeyPart extract key from request and return the string
+func (opt UseHeaderKey) KeyPart(r *http.Request) (string, error) {
+	return joinValues(r.Header.Values(opt.Key)), nil
 }
 
-// ExtractBool does nothing but return false
-// (function required to match the interface)
-func (opt UseHeaderKey) ExtractBool(r *http.Request) bool { return false }
+func (opt UseHeaderKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
 
-// AllowBypassHeader enable a client to set the `Cache-Status`
-// header to `bypass` so he will not get cached data
-type AllowBypassHeader struct{ Key, Value string }
+// UseCookieKey tells the cache to use cookie value for given name
+// as part of the key. Values are escaped and joined with `,` after their count.
+type UseCookieKey struct{ Key string }
 
-// ExtractString does nothing but return empty string
-// (function required to match the interface)
-func (opt AllowBypassHeader) ExtractString(r *http.Request) string { return "" }
+// KeyPart extract key from request and return the string
+func (opt UseCookieKey) KeyPart(r *http.Request) (string, error) {
+	values := []string{}
+	for _, cookie := range r.Cookies() {
+		if cookie.Name == opt.Key {
+			values = append(values, cookie.Value)
+		}
+	}
+	return joinValues(values), nil
+}
 
-// ExtractBool check if request can bypass depending on request
-func (opt AllowBypassHeader) ExtractBool(r *http.Request) bool {
-	if val, ok := r.Header[opt.Key]; ok && val[0] == opt.Value {
-		for _, v := range val {
-			if v == opt.Value {
-				return true
-			}
+func (opt UseCookieKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
+
+// joinValues escapes the values and joins them with `,` after their count,
+// e.g. `0:` for no value and `1:` for an empty value
+func joinValues(values []string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = url.QueryEscape(value)
+	}
+	return fmt.Sprintf("%d:%s", len(values), strings.Join(escaped, ","))
+}
+
+// UseHostKey tells the cache to use the lower case host of the request
+// as part of the key
+type UseHostKey struct{}
+
+// KeyPart extract key from request and return the string
+func (opt UseHostKey) KeyPart(r *http.Request) (string, error) {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	return strings.ToLower(host), nil
+}
+
+func (opt UseHostKey) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, opt) }
+
+// UseSchemeKey tells the cache to use the scheme (`http` or `https`) as part of the key.
+// The `X-Forwarded-Proto` header is used if the request comes from one
+// of the TrustedProxies, which are IP addresses or CIDR ranges.
+// Used as option it panics if a trusted proxy is invalid.
+type UseSchemeKey struct {
+	TrustedProxies []string
+	trusted        trustedProxies
+}
+
+// KeyPart extract key from request and return the string
+func (opt UseSchemeKey) KeyPart(r *http.Request) (string, error) {
+	trusted, err := opt.trusted.orParse(opt.TrustedProxies)
+	if err != nil {
+		return "", err
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && len(trusted) > 0 {
+		if addr, err := remoteAddr(r); err == nil && trusted.contains(addr) {
+			return strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0])), nil
 		}
 	}
 
-	return false
+	if r.TLS != nil {
+		return "https", nil
+	}
+	if r.URL.Scheme != "" {
+		return strings.ToLower(r.URL.Scheme), nil
+	}
+	return "http", nil
+}
+
+func (opt UseSchemeKey) apply(cm *cacheManager) {
+	opt.trusted = mustTrustedProxies(opt.TrustedProxies)
+	cm.KeyParts = append(cm.KeyParts, opt)
+}
+
+// UseRemoteIPKey tells the cache to use the IP address of the client as part of the key.
+// If the request comes from one of the TrustedProxies, which are IP addresses or CIDR ranges,
+// the `X-Forwarded-For` header is read from right to left and the first address
+// that is not a trusted proxy is used.
+// Used as option it panics if a trusted proxy is invalid.
+type UseRemoteIPKey struct {
+	TrustedProxies []string
+	trusted        trustedProxies
 }
 
+// KeyPart extract key from request and return the string
+func (opt UseRemoteIPKey) KeyPart(r *http.Request) (string, error) {
+	trusted, err := opt.trusted.orParse(opt.TrustedProxies)
+	if err != nil {
+		return "", err
+	}
+	addr, err := remoteAddr(r)
+	if err != nil {
+		return "", err
+	}
+
+	return trusted.clientAddr(addr, r.Header.Values("X-Forwarded-For")).String(), nil
+}
+
+func (opt UseRemoteIPKey) apply(cm *cacheManager) {
+	opt.trusted = mustTrustedProxies(opt.TrustedProxies)
+	cm.KeyParts = append(cm.KeyParts, opt)
+}
+
+// AllowBypassHeader enable a client to set the `Cache-Status`
+// header to `bypass` so he will not get cached data
+type AllowBypassHeader struct{ Key, Value string }
+
+// Bypass check if request can bypass depending on request
+func (opt AllowBypassHeader) Bypass(r *http.Request) bool {
+	return slices.Contains(r.Header.Values(opt.Key), opt.Value)
+}
+
+func (opt AllowBypassHeader) apply(cm *cacheManager) { cm.BypassRules = append(cm.BypassRules, opt) }
+
 // AllowBypassMethod defined methods that automatically bypass the caching e.g. post or put
 type AllowBypassMethod struct{ Key string }
 
-// ExtractString does nothing but return empty string
-// (function required to match the interface)
-func (opt AllowBypassMethod) ExtractString(r *http.Request) string { return "" }
+// Bypass check if request can bypass depending on request
+func (opt AllowBypassMethod) Bypass(r *http.Request) bool {
+	return strings.EqualFold(opt.Key, r.Method)
+}
+
+func (opt AllowBypassMethod) apply(cm *cacheManager) {
+	opt.Key = strings.ToLower(opt.Key)
+	cm.BypassRules = append(cm.BypassRules, opt)
+}
+
+// KeyFunc is a key part implemented by a function.
+// If an error is returned the request bypasses the cache.
+type KeyFunc func(r *http.Request) (string, error)
+
+// KeyPart calls the function
+func (fn KeyFunc) KeyPart(r *http.Request) (string, error) {
+	return fn(r)
+}
 
-// ExtractBool check if request can bypass depending on request
-func (opt AllowBypassMethod) ExtractBool(r *http.Request) bool {
-	return opt.Key == strings.ToLower(r.Method)
+func (fn KeyFunc) apply(cm *cacheManager) { cm.KeyParts = append(cm.KeyParts, fn) }
+
+// BypassFunc is a bypass rule implemented by a function
+type BypassFunc func(r *http.Request) bool
+
+// Bypass calls the function
+func (fn BypassFunc) Bypass(r *http.Request) bool {
+	return fn(r)
+}
+
+func (fn BypassFunc) apply(cm *cacheManager) { cm.BypassRules = append(cm.BypassRules, fn) }
+
+// And returns a rule that bypasses the cache if all rules do
+func And(rules ...BypassRule) BypassFunc {
+	return func(r *http.Request) bool {
+		for _, rule := range rules {
+			if !rule.Bypass(r) {
+				return false
+			}
+		}
+		return len(rules) > 0
+	}
+}
+
+// Or returns a rule that bypasses the cache if any rule does
+func Or(rules ...BypassRule) BypassFunc {
+	return func(r *http.Request) bool {
+		for _, rule := range rules {
+			if rule.Bypass(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a rule that bypasses the cache if the rule doesn't
+func Not(rule BypassRule) BypassFunc {
+	return func(r *http.Request) bool {
+		return !rule.Bypass(r)
+	}
 }
@@ -1,10 +1,14 @@
 package cache_handler
 
 import (
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUsePathKey(t *testing.T) {
@@ -12,7 +16,7 @@ func TestUsePathKey(t *testing.T) {
 	assert.NoError(t, err)
 
 	uk := UsePathKey{}
-	assert.Equal(t, "/sub", uk.ExtractString(r))
+	assertKeyPart(t, "/sub", uk, r)
 }
 
 func TestUseMethodKey(t *testing.T) {
@@ -20,7 +24,7 @@ func TestUseMethodKey(t *testing.T) {
 	assert.NoError(t, err)
 
 	uk := UseMethodKey{}
-	assert.Equal(t, "POST", uk.ExtractString(r))
+	assertKeyPart(t, "POST", uk, r)
 }
 
 func TestUseQueryParamsKey(t *testing.T) {
@@ -28,11 +32,61 @@ func TestUseQueryParamsKey(t *testing.T) {
 	assert.NoError(t, err)
 
 	uk := UseQueryParamsKey{Key: "name"}
-	assert.Equal(t, "abc", uk.ExtractString(r))
+	assertKeyPart(t, "name=abc", uk, r)
 	uk = UseQueryParamsKey{Key: "role"}
-	assert.Equal(t, "a/b", uk.ExtractString(r))
+	assertKeyPart(t, "role=a&role=b", uk, r)
 	uk = UseQueryParamsKey{Key: "not_exists"}
-	assert.Equal(t, "", uk.ExtractString(r))
+	assertKeyPart(t, "", uk, r)
+}
+
+func TestUseQueryParamsKeyMultipleValues(t *testing.T) {
+	uk := UseQueryParamsKey{Key: "a"}
+	keyOf := func(query string) string {
+		r, err := http.NewRequest("GET", "https://not-exists.com/sub?"+query, nil)
+		assert.NoError(t, err)
+		key, err := uk.KeyPart(r)
+		assert.NoError(t, err)
+		return key
+	}
+
+	assert.NotEqual(t, keyOf("a=1&a=2"), keyOf("a=1/2"))
+	assert.NotEqual(t, keyOf("a=1&a=2"), keyOf("a=1%262"))
+	assert.NotEqual(t, keyOf(""), keyOf("a="))
+}
+
+func TestUseQueryKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      UseQueryKey
+		query    string
+		expected string
+	}{
+		{"empty", UseQueryKey{}, "", ""},
+		{"sorted", UseQueryKey{}, "b=2&a=1", "a=1&b=2"},
+		{"decoded", UseQueryKey{}, "a=%31&b=x+y", "a=1&b=x+y"},
+		{"deduped", UseQueryKey{}, "a=2&a=1&a=2", "a=2&a=1"},
+		{"multiple values", UseQueryKey{}, "a=1&a=2", "a=1&a=2"},
+		{"escaped values", UseQueryKey{}, "a=1%262", "a=1%262"},
+		{"exclude", UseQueryKey{Exclude: []string{"utm_*", "ref"}}, "page=1&utm_source=x&utm_medium=y&ref=z", "page=1"},
+		{"include", UseQueryKey{Include: []string{"page", "sort"}}, "page=1&sort=name&session=abc", "page=1&sort=name"},
+		{"include and exclude", UseQueryKey{Include: []string{"f_*"}, Exclude: []string{"f_debug"}}, "f_a=1&f_debug=1&b=2", "f_a=1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "https://not-exists.com/sub?"+test.query, nil)
+			assert.NoError(t, err)
+			assertKeyPart(t, test.expected, test.key, r)
+		})
+	}
+}
+
+func TestUseQueryKeyInvalidQuery(t *testing.T) {
+	r, err := http.NewRequest("GET", "https://not-exists.com/sub?a=%zz", nil)
+	assert.NoError(t, err)
+
+	_, err = UseQueryKey{}.KeyPart(r)
+	assert.Error(t, err)
 }
 
 func TestUseHeaderKey(t *testing.T) {
@@ -41,9 +95,95 @@ func TestUseHeaderKey(t *testing.T) {
 	r.Header.Add("Cache-Status", "bypass")
 
 	uk := UseHeaderKey{Key: "Cache-Status"}
-	assert.Equal(t, "bypass", uk.ExtractString(r))
+	assertKeyPart(t, "1:bypass", uk, r)
 	uk = UseHeaderKey{Key: "not_exists"}
-	assert.Equal(t, "", uk.ExtractString(r))
+	assertKeyPart(t, "0:", uk, r)
+
+	r.Header.Add("X-Empty", "")
+	uk = UseHeaderKey{Key: "X-Empty"}
+	assertKeyPart(t, "1:", uk, r)
+
+	r.Header.Add("X-Roles", "a b")
+	r.Header.Add("X-Roles", "c,d")
+	uk = UseHeaderKey{Key: "x-roles"}
+	assertKeyPart(t, "2:a+b,c%2Cd", uk, r)
+}
+
+func TestUseCookieKey(t *testing.T) {
+	r, err := http.NewRequest("GET", "https://not-exists.com/sub", nil)
+	assert.NoError(t, err)
+	r.Header.Add("Cookie", "session=abc; theme=dark; session=a,b; empty=")
+
+	uk := UseCookieKey{Key: "session"}
+	assertKeyPart(t, "2:abc,a%2Cb", uk, r)
+	uk = UseCookieKey{Key: "theme"}
+	assertKeyPart(t, "1:dark", uk, r)
+	uk = UseCookieKey{Key: "empty"}
+	assertKeyPart(t, "1:", uk, r)
+	uk = UseCookieKey{Key: "not_exists"}
+	assertKeyPart(t, "0:", uk, r)
+}
+
+func TestUseHostKey(t *testing.T) {
+	r, err := http.NewRequest("GET", "https://Tenant-A.example.com/sub", nil)
+	assert.NoError(t, err)
+	assertKeyPart(t, "tenant-a.example.com", UseHostKey{}, r)
+
+	r.Host = "tenant-b.example.com:8080"
+	assertKeyPart(t, "tenant-b.example.com:8080", UseHostKey{}, r)
+}
+
+func TestUseSchemeKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/sub", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assertKeyPart(t, "http", UseSchemeKey{}, r)
+
+	r.Header.Set("X-Forwarded-Proto", "HTTPS")
+	assertKeyPart(t, "http", UseSchemeKey{}, r)
+	assertKeyPart(t, "http", UseSchemeKey{TrustedProxies: []string{"10.0.0.2"}}, r)
+	assertKeyPart(t, "https", UseSchemeKey{TrustedProxies: []string{"10.0.0.0/8"}}, r)
+
+	r = httptest.NewRequest("GET", "https://not-exists.com/sub", nil)
+	assertKeyPart(t, "https", UseSchemeKey{}, r)
+
+	_, err := UseSchemeKey{TrustedProxies: []string{"proxy"}}.KeyPart(httptest.NewRequest("GET", "/", nil))
+	assert.Error(t, err)
+}
+
+func TestUseRemoteIPKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/sub", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Add("X-Forwarded-For", "203.0.113.7, 198.51.100.1")
+	r.Header.Add("X-Forwarded-For", "10.0.0.2")
+
+	assertKeyPart(t, "10.0.0.1", UseRemoteIPKey{}, r)
+	assertKeyPart(t, "10.0.0.2", UseRemoteIPKey{TrustedProxies: []string{"10.0.0.1"}}, r)
+	assertKeyPart(t, "198.51.100.1", UseRemoteIPKey{TrustedProxies: []string{"10.0.0.0/8"}}, r)
+	assertKeyPart(t, "203.0.113.7", UseRemoteIPKey{TrustedProxies: []string{"10.0.0.0/8", "198.51.100.1"}}, r)
+
+	r.RemoteAddr = "[::ffff:192.0.2.1]:1234"
+	assertKeyPart(t, "192.0.2.1", UseRemoteIPKey{TrustedProxies: []string{"10.0.0.0/8"}}, r)
+
+	r.RemoteAddr = "pipe"
+	_, err := UseRemoteIPKey{}.KeyPart(r)
+	assert.Error(t, err)
+}
+
+func TestTrustedProxiesParsedAtSetup(t *testing.T) {
+	cm := newCacheManager(nil,
+		UseSchemeKey{TrustedProxies: []string{"10.0.0.0/8"}},
+		WithKeyPart(UseRemoteIPKey{TrustedProxies: []string{"10.0.0.1"}}))
+	require.Len(t, cm.KeyParts, 3)
+	assert.Equal(t, trustedProxies{netip.MustParsePrefix("10.0.0.0/8")}, cm.KeyParts[1].(UseSchemeKey).trusted)
+	assert.Equal(t, trustedProxies{netip.MustParsePrefix("10.0.0.1/32")}, cm.KeyParts[2].(UseRemoteIPKey).trusted)
+	assert.NotNil(t, newCacheManager(nil, UseRemoteIPKey{}).KeyParts[1].(UseRemoteIPKey).trusted)
+
+	assert.PanicsWithValue(t, `cache_handler: invalid trusted proxy "proxy": ParseAddr("proxy"): unable to parse IP`, func() {
+		NewMiddleware(nil, nil, UseSchemeKey{TrustedProxies: []string{"proxy"}})
+	})
+	assert.Panics(t, func() {
+		newCacheManager(nil, WithRoute("/users", UseRemoteIPKey{TrustedProxies: []string{"10.0.0.0/33"}}))
+	})
 }
 
 func TestAllowBypassHeader(t *testing.T) {
@@ -51,17 +191,24 @@ func TestAllowBypassHeader(t *testing.T) {
 
 	r, err := http.NewRequest("POST", "https://not-exists.com/sub", nil)
 	assert.NoError(t, err)
-	assert.False(t, abh.ExtractBool(r))
+	assert.False(t, abh.Bypass(r))
 
 	r, err = http.NewRequest("POST", "https://not-exists.com/sub", nil)
 	assert.NoError(t, err)
 	r.Header.Add("Cache-Status", "wrong")
-	assert.False(t, abh.ExtractBool(r))
+	assert.False(t, abh.Bypass(r))
 
 	r, err = http.NewRequest("POST", "https://not-exists.com/sub", nil)
 	assert.NoError(t, err)
 	r.Header.Add("Cache-Status", "bypass")
-	assert.True(t, abh.ExtractBool(r))
+	assert.True(t, abh.Bypass(r))
+
+	abh = AllowBypassHeader{Key: "cache-control", Value: "no-cache"}
+	r, err = http.NewRequest("POST", "https://not-exists.com/sub", nil)
+	assert.NoError(t, err)
+	r.Header.Add("Cache-Control", "max-age=0")
+	r.Header.Add("Cache-Control", "no-cache")
+	assert.True(t, abh.Bypass(r))
 }
 
 func TestAllowBypassMethod(t *testing.T) {
@@ -69,17 +216,70 @@ func TestAllowBypassMethod(t *testing.T) {
 
 	r, err := http.NewRequest("get", "https://not-exists.com/sub", nil)
 	assert.NoError(t, err)
-	assert.False(t, abm.ExtractBool(r))
+	assert.False(t, abm.Bypass(r))
 
 	r, err = http.NewRequest("post", "https://not-exists.com/sub", nil)
 	assert.NoError(t, err)
-	assert.True(t, abm.ExtractBool(r))
+	assert.True(t, abm.Bypass(r))
 
 	r, err = http.NewRequest("POST", "https://not-exists.com/sub", nil)
 	assert.NoError(t, err)
-	assert.True(t, abm.ExtractBool(r))
+	assert.True(t, abm.Bypass(r))
 
 	r, err = http.NewRequest("post", "https://not-exists.com/sub", nil)
 	assert.NoError(t, err)
-	assert.True(t, abm.ExtractBool(r))
+	assert.True(t, abm.Bypass(r))
+}
+
+func TestKeyFunc(t *testing.T) {
+	tenant := KeyFunc(func(r *http.Request) (string, error) {
+		if tenant := r.Header.Get("X-Tenant"); tenant != "" {
+			return tenant, nil
+		}
+		return "", errors.New("missing tenant")
+	})
+
+	r := httptest.NewRequest("GET", "/sub", nil)
+	_, err := tenant.KeyPart(r)
+	assert.EqualError(t, err, "missing tenant")
+
+	r.Header.Set("X-Tenant", "acme")
+	assertKeyPart(t, "acme", tenant, r)
+
+	cm := cacheManager{}
+	cm.useOptions(tenant)
+	assert.Len(t, cm.KeyParts, 1)
+}
+
+func TestBypassFunc(t *testing.T) {
+	admin := BypassFunc(func(r *http.Request) bool { return r.Header.Get("X-Role") == "admin" })
+	post := AllowBypassMethod{Key: "POST"}
+	debug := AllowBypassHeader{Key: "X-Debug", Value: "1"}
+
+	r := httptest.NewRequest("POST", "/sub", nil)
+	assert.False(t, admin.Bypass(r))
+	assert.False(t, And(admin, post).Bypass(r))
+	assert.True(t, Or(admin, post).Bypass(r))
+	assert.True(t, Not(admin).Bypass(r))
+
+	r.Header.Set("X-Role", "admin")
+	assert.True(t, admin.Bypass(r))
+	assert.True(t, And(admin, post).Bypass(r))
+	assert.False(t, And(admin, post, debug).Bypass(r))
+	assert.True(t, And(admin, Not(debug)).Bypass(r))
+	assert.True(t, Or(debug, And(admin, post)).Bypass(r))
+	assert.False(t, Not(admin).Bypass(r))
+
+	assert.False(t, And().Bypass(r))
+	assert.False(t, Or().Bypass(r))
+
+	cm := cacheManager{}
+	cm.useOptions(admin, Or(admin, post))
+	assert.Len(t, cm.BypassRules, 2)
+}
+
+func assertKeyPart(t *testing.T, expected string, part KeyPart, r *http.Request) {
+	value, err := part.KeyPart(r)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, value)
 }
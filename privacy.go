@@ -0,0 +1,89 @@
+package cache_handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WithAllowSetCookie stores responses that set cookies.
+// By default they are not stored, they likely belong to a session of one user.
+// The `Set-Cookie` header itself is never stored or served from the cache.
+func WithAllowSetCookie() Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.AllowSetCookie = true
+	})
+}
+
+// WithAllowPrivate stores responses with `Cache-Control: private`.
+// By default they are not stored, they are intended for a single user.
+func WithAllowPrivate() Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.AllowPrivate = true
+	})
+}
+
+// WithAllowCredentials serves requests with `Authorization` or `Cookie` headers from the cache
+// even if the key doesn't include them, e.g. if a KeyFunc keys on the user.
+// By default these requests bypass the cache, unless the key includes the `Authorization`
+// header with UseHeaderKey or the cookies with UseCookieKey or UseHeaderKey.
+func WithAllowCredentials() Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.AllowCredentials = true
+	})
+}
+
+// unkeyedCredential returns the name of a credential header of the request
+// the key doesn't include, or an empty string if the request can use the cache
+func (cm cacheManager) unkeyedCredential(r *http.Request) string {
+	if cm.AllowCredentials {
+		return ""
+	}
+
+	authorization, cookie := false, false
+	for _, part := range cm.KeyParts {
+		switch part := part.(type) {
+		case UseHeaderKey:
+			authorization = authorization || strings.EqualFold(part.Key, "Authorization")
+			cookie = cookie || strings.EqualFold(part.Key, "Cookie")
+		case UseCookieKey:
+			cookie = true
+		}
+	}
+
+	if !authorization && r.Header.Get("Authorization") != "" {
+		return "Authorization"
+	}
+	if !cookie && r.Header.Get("Cookie") != "" {
+		return "Cookie"
+	}
+
+	return ""
+}
+
+// privateReason returns why a response with given header must not be stored
+// in a shared cache, or an empty string if it can be stored
+func (cm cacheManager) privateReason(header http.Header) string {
+	if !cm.AllowSetCookie && len(header.Values("Set-Cookie")) > 0 {
+		return "it sets cookies"
+	}
+	if !cm.AllowPrivate && hasCacheControl(header, "private") {
+		return "it is private"
+	}
+
+	return ""
+}
+
+// hasCacheControl returns if the `Cache-Control` header has the directive,
+// with or without an argument
+func hasCacheControl(header http.Header, directive string) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, field := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(field, "=")
+			if strings.EqualFold(strings.TrimSpace(name), directive) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
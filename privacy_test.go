@@ -0,0 +1,115 @@
+package cache_handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/metrics"
+	"github.com/StevenCyb/cache_handler/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnkeyedCredential(t *testing.T) {
+	authorization := http.Header{"Authorization": {"Bearer token"}}
+	cookie := http.Header{"Cookie": {"session=secret"}}
+
+	for _, tc := range []struct {
+		opts     []Option
+		header   http.Header
+		expected string
+	}{
+		{nil, http.Header{}, ""},
+		{nil, authorization, "Authorization"},
+		{nil, cookie, "Cookie"},
+		{[]Option{UseHeaderKey{Key: "authorization"}}, authorization, ""},
+		{[]Option{UseHeaderKey{Key: "Authorization"}}, cookie, "Cookie"},
+		{[]Option{UseCookieKey{Key: "session"}}, cookie, ""},
+		{[]Option{UseHeaderKey{Key: "Cookie"}}, cookie, ""},
+		{[]Option{UseCookieKey{Key: "session"}}, authorization, "Authorization"},
+		{[]Option{WithAllowCredentials()}, authorization, ""},
+		{[]Option{WithAllowCredentials()}, cookie, ""},
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header = tc.header
+		assert.Equal(t, tc.expected, newCacheManager(nil, tc.opts...).unkeyedCredential(r), "%+v %v", tc.opts, tc.header)
+	}
+}
+
+func TestPrivateReason(t *testing.T) {
+	cm := newCacheManager(nil)
+	assert.Empty(t, cm.privateReason(http.Header{}))
+	assert.Empty(t, cm.privateReason(http.Header{"Cache-Control": {"public, max-age=60"}}))
+	assert.Equal(t, "it sets cookies", cm.privateReason(http.Header{"Set-Cookie": {"session=secret"}}))
+	assert.Equal(t, "it is private", cm.privateReason(http.Header{"Cache-Control": {"max-age=60, Private"}}))
+	assert.Equal(t, "it is private", cm.privateReason(http.Header{"Cache-Control": {`private="Set-Cookie"`}}))
+
+	cm = newCacheManager(nil, WithAllowSetCookie(), WithAllowPrivate())
+	assert.Empty(t, cm.privateReason(http.Header{"Set-Cookie": {"session=secret"}, "Cache-Control": {"private"}}))
+}
+
+func TestMiddlewarePrivateResponses(t *testing.T) {
+	calls := 0
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	registry := metrics.NewRegistry()
+	next := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Set-Cookie", "session=secret")
+		case "/profile":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		}
+		w.Write([]byte(strconv.Itoa(calls)))
+	}
+	handler := NewMiddleware(next, s, WithMetrics(registry))
+
+	request(t, &handler, "GET", "/login", http.Header{}, 1)
+	request(t, &handler, "GET", "/login", http.Header{}, 2)
+	request(t, &handler, "GET", "/profile", http.Header{}, 3)
+	request(t, &handler, "GET", "/profile", http.Header{}, 4)
+	request(t, &handler, "GET", "/public", http.Header{}, 5)
+	request(t, &handler, "GET", "/public", http.Header{}, 5)
+	assert.Equal(t, int64(4), registry.Counter("cache.uncacheable"))
+
+	calls = 0
+	allowed := store.NewInMemoryStore(time.Hour)
+	defer allowed.Close()
+	handler = NewMiddleware(next, allowed, WithAllowSetCookie(), WithAllowPrivate())
+	request(t, &handler, "GET", "/login", http.Header{}, 1)
+	request(t, &handler, "GET", "/login", http.Header{}, 1)
+	request(t, &handler, "GET", "/profile", http.Header{}, 2)
+	request(t, &handler, "GET", "/profile", http.Header{}, 2)
+}
+
+func TestMiddlewareCredentials(t *testing.T) {
+	calls := 0
+	logs := &bytes.Buffer{}
+	s := store.NewInMemoryStore(time.Hour)
+	defer s.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(strconv.Itoa(calls)))
+	}, s, WithLogger(slog.New(slog.NewTextHandler(logs, nil))),
+		WithRoute("/users", UseHeaderKey{Key: "Authorization"}))
+
+	alice := http.Header{"Authorization": {"alice"}}
+	request(t, &handler, "GET", "/", http.Header{}, 1)
+	request(t, &handler, "GET", "/", alice, 2)
+	request(t, &handler, "GET", "/", alice, 3)
+	request(t, &handler, "GET", "/", http.Header{"Cookie": {"session=secret"}}, 4)
+	request(t, &handler, "GET", "/", http.Header{}, 1)
+	assert.Contains(t, logs.String(),
+		`level=WARN msg="bypassing cache, the key doesn't include the credentials of the request"`)
+	assert.Contains(t, logs.String(), "header=Authorization method=GET path=/")
+	assert.Contains(t, logs.String(), "header=Cookie method=GET path=/")
+
+	request(t, &handler, "GET", "/users", alice, 5)
+	request(t, &handler, "GET", "/users", alice, 5)
+	request(t, &handler, "GET", "/users", http.Header{"Authorization": {"bob"}}, 6)
+}
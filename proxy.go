@@ -0,0 +1,102 @@
+package cache_handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies are the address ranges of proxies whose forwarding headers are trusted
+type trustedProxies []netip.Prefix
+
+// newTrustedProxies parses IP addresses and CIDR ranges
+func newTrustedProxies(proxies []string) (trustedProxies, error) {
+	trusted := make(trustedProxies, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			trusted = append(trusted, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return trusted, nil
+}
+
+// mustTrustedProxies parses the trusted proxies of an option, it panics if one is invalid
+func mustTrustedProxies(proxies []string) trustedProxies {
+	trusted, err := newTrustedProxies(proxies)
+	if err != nil {
+		panic("cache_handler: " + err.Error())
+	}
+
+	return trusted
+}
+
+// orParse returns the parsed trusted proxies or parses the proxies
+// if they were not parsed when the option was applied
+func (trusted trustedProxies) orParse(proxies []string) (trustedProxies, error) {
+	if trusted != nil {
+		return trusted, nil
+	}
+
+	return newTrustedProxies(proxies)
+}
+
+// contains returns if the address is a trusted proxy
+func (trusted trustedProxies) contains(addr netip.Addr) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientAddr returns the address of the client for a request from addr
+// with given `X-Forwarded-For` headers. The forwarded addresses are read
+// from right to left as long as the request was passed on by a trusted proxy.
+func (trusted trustedProxies) clientAddr(addr netip.Addr, forwardedFor []string) netip.Addr {
+	forwarded := []string{}
+	for _, header := range forwardedFor {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0 && trusted.contains(addr); i-- {
+		next, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = next.Unmap()
+	}
+
+	return addr
+}
+
+// remoteAddr returns the IP address of the peer of the request
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid remote address %q: %w", r.RemoteAddr, err)
+	}
+
+	return addr.Unmap(), nil
+}
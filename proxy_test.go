@@ -0,0 +1,39 @@
+package cache_handler
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	trusted, err := newTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32", "::ffff:198.51.100.1"})
+	assert.NoError(t, err)
+
+	assert.True(t, trusted.contains(netip.MustParseAddr("10.1.2.3")))
+	assert.True(t, trusted.contains(netip.MustParseAddr("192.0.2.1")))
+	assert.True(t, trusted.contains(netip.MustParseAddr("198.51.100.1")))
+	assert.True(t, trusted.contains(netip.MustParseAddr("2001:db8::1")))
+	assert.False(t, trusted.contains(netip.MustParseAddr("192.0.2.2")))
+	assert.False(t, trusted.contains(netip.MustParseAddr("2001:db9::1")))
+
+	_, err = newTrustedProxies([]string{"10.0.0.0/33"})
+	assert.ErrorContains(t, err, `invalid trusted proxy "10.0.0.0/33"`)
+	_, err = newTrustedProxies([]string{"localhost"})
+	assert.ErrorContains(t, err, `invalid trusted proxy "localhost"`)
+}
+
+func TestTrustedProxiesClientAddr(t *testing.T) {
+	trusted, err := newTrustedProxies([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	proxy := netip.MustParseAddr("10.0.0.1")
+
+	assert.Equal(t, proxy, trusted.clientAddr(proxy, nil))
+	assert.Equal(t, "203.0.113.7", trusted.clientAddr(proxy, []string{"203.0.113.7"}).String())
+	// a client can't spoof its address by sending its own header
+	assert.Equal(t, "203.0.113.7", trusted.clientAddr(proxy, []string{"1.2.3.4, 203.0.113.7, 10.0.0.3"}).String())
+	assert.Equal(t, "203.0.113.7", trusted.clientAddr(netip.MustParseAddr("203.0.113.7"), []string{"1.2.3.4"}).String())
+	// stops at invalid addresses
+	assert.Equal(t, "10.0.0.2", trusted.clientAddr(proxy, []string{"garbage, 10.0.0.2"}).String())
+}
@@ -1,15 +1,26 @@
 package cache_handler
 
 import (
+	"bufio"
 	"bytes"
+	"io"
+	"net"
 	"net/http"
 )
 
 // HttpRecorder is a custom response writer that
-// records the body
+// records the status code and the body.
+// If MaxSize is set the recorder stops recording once the body exceeds it,
+// discards the recorded part and sets Exceeded, the response is still sent.
+// Use Writer to pass the recorder to handlers that need optional interfaces like http.Flusher.
 type HttpRecorder struct {
 	http.ResponseWriter
-	Body *bytes.Buffer
+	Body     *bytes.Buffer
+	Status   int
+	MaxSize  int
+	Exceeded bool
+	Flushed  bool
+	Hijacked bool
 }
 
 // NewHttpRecorder create a new NewHttpRecorder with given ResponseWriter
@@ -20,22 +31,274 @@ func NewHttpRecorder(responseWriter http.ResponseWriter) *HttpRecorder {
 	}
 }
 
-// Write byte data is written to rw.Body, if not nil.
+// WriteHeader records the first final status code and sends it
+func (hr *HttpRecorder) WriteHeader(status int) {
+	if hr.Status == 0 && status >= http.StatusOK {
+		hr.Status = status
+	}
+	hr.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends the data and records it to rw.Body, if not nil
+// and the size limit is not exceeded.
 func (hr *HttpRecorder) Write(buf []byte) (int, error) {
-	if hr.Body != nil {
-		hr.Body.Write(buf)
-		return hr.ResponseWriter.Write(buf)
+	if hr.Status == 0 {
+		hr.Status = http.StatusOK
+	}
+	if hr.Body != nil && !hr.Exceeded {
+		if hr.MaxSize > 0 && hr.Body.Len()+len(buf) > hr.MaxSize {
+			hr.Exceeded = true
+			hr.Body = &bytes.Buffer{}
+		} else {
+			hr.Body.Write(buf)
+		}
 	}
 
-	return len(buf), nil
+	return hr.ResponseWriter.Write(buf)
 }
 
-// WriteString string data is written to rw.Body, if not nil.
+// WriteString sends the string and records it like Write
 func (hr *HttpRecorder) WriteString(str string) (int, error) {
-	if hr.Body != nil {
-		hr.Body.WriteString(str)
-		return hr.ResponseWriter.Write([]byte(str))
+	return hr.Write([]byte(str))
+}
+
+// Writer returns a response writer that records like the recorder and
+// implements exactly the optional interfaces http.Flusher, http.Hijacker,
+// io.ReaderFrom and http.Pusher the underlying writer implements.
+// Like http.ResponseController, flushing and hijacking are also supported
+// if a writer the underlying writer unwraps to supports them.
+// Flushed and hijacked responses are marked with Flushed and Hijacked.
+func (hr *HttpRecorder) Writer() http.ResponseWriter {
+	var (
+		f  http.Flusher
+		h  http.Hijacker
+		rf io.ReaderFrom
+		p  http.Pusher
+	)
+	if canFlush(hr.ResponseWriter) {
+		f = recorderFlusher{hr}
+	}
+	if canHijack(hr.ResponseWriter) {
+		h = recorderHijacker{hr}
+	}
+	if _, ok := hr.ResponseWriter.(io.ReaderFrom); ok {
+		rf = recorderReaderFrom{hr}
+	}
+	if _, ok := hr.ResponseWriter.(http.Pusher); ok {
+		p = recorderPusher{hr}
+	}
+
+	return withOptionalInterfaces(hr, f, h, rf, p)
+}
+
+// canFlush returns if w or a writer it unwraps to can flush, like http.ResponseController checks it
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch t := w.(type) {
+		case interface{ FlushError() error }, http.Flusher:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// canHijack returns if w or a writer it unwraps to can hijack, like http.ResponseController checks it
+func canHijack(w http.ResponseWriter) bool {
+	for {
+		switch t := w.(type) {
+		case http.Hijacker:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// controllerHijacker hijacks with the writer or a writer it unwraps to
+type controllerHijacker struct{ w http.ResponseWriter }
+
+func (h controllerHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(h.w).Hijack()
+}
+
+// unwrapWriter is a response writer that wraps another one
+type unwrapWriter interface {
+	http.ResponseWriter
+	Unwrap() http.ResponseWriter
+}
+
+// withOptionalInterfaces returns a writer that implements exactly
+// the optional interfaces that are not nil
+func withOptionalInterfaces(w unwrapWriter, f http.Flusher, h http.Hijacker, rf io.ReaderFrom, p http.Pusher) http.ResponseWriter {
+	const (
+		flusher = 1 << iota
+		hijacker
+		readerFrom
+		pusher
+	)
+
+	supported := 0
+	if f != nil {
+		supported |= flusher
+	}
+	if h != nil {
+		supported |= hijacker
+	}
+	if rf != nil {
+		supported |= readerFrom
+	}
+	if p != nil {
+		supported |= pusher
+	}
+
+	switch supported {
+	case flusher:
+		return struct {
+			unwrapWriter
+			http.Flusher
+		}{w, f}
+	case hijacker:
+		return struct {
+			unwrapWriter
+			http.Hijacker
+		}{w, h}
+	case flusher | hijacker:
+		return struct {
+			unwrapWriter
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case readerFrom:
+		return struct {
+			unwrapWriter
+			io.ReaderFrom
+		}{w, rf}
+	case flusher | readerFrom:
+		return struct {
+			unwrapWriter
+			http.Flusher
+			io.ReaderFrom
+		}{w, f, rf}
+	case hijacker | readerFrom:
+		return struct {
+			unwrapWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{w, h, rf}
+	case flusher | hijacker | readerFrom:
+		return struct {
+			unwrapWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{w, f, h, rf}
+	case pusher:
+		return struct {
+			unwrapWriter
+			http.Pusher
+		}{w, p}
+	case flusher | pusher:
+		return struct {
+			unwrapWriter
+			http.Flusher
+			http.Pusher
+		}{w, f, p}
+	case hijacker | pusher:
+		return struct {
+			unwrapWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case flusher | hijacker | pusher:
+		return struct {
+			unwrapWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, f, h, p}
+	case readerFrom | pusher:
+		return struct {
+			unwrapWriter
+			io.ReaderFrom
+			http.Pusher
+		}{w, rf, p}
+	case flusher | readerFrom | pusher:
+		return struct {
+			unwrapWriter
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{w, f, rf, p}
+	case hijacker | readerFrom | pusher:
+		return struct {
+			unwrapWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{w, h, rf, p}
+	case flusher | hijacker | readerFrom | pusher:
+		return struct {
+			unwrapWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{w, f, h, rf, p}
+	}
+
+	return w
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (hr *HttpRecorder) Unwrap() http.ResponseWriter {
+	return hr.ResponseWriter
+}
+
+// recorderFlusher marks the response as flushed before flushing it
+type recorderFlusher struct{ hr *HttpRecorder }
+
+func (f recorderFlusher) Flush() {
+	if f.hr.Status == 0 {
+		f.hr.Status = http.StatusOK
 	}
+	f.hr.Flushed = true
+	http.NewResponseController(f.hr.ResponseWriter).Flush()
+}
+
+// recorderHijacker marks the response as hijacked before hijacking the connection
+type recorderHijacker struct{ hr *HttpRecorder }
+
+func (h recorderHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hr.Hijacked = true
+	return http.NewResponseController(h.hr.ResponseWriter).Hijack()
+}
+
+// recorderReaderFrom records the data read from src, once nothing
+// is recorded anymore the underlying io.ReaderFrom is used
+type recorderReaderFrom struct{ hr *HttpRecorder }
+
+func (rf recorderReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	if rf.hr.Status == 0 {
+		rf.hr.Status = http.StatusOK
+	}
+	if rf.hr.Body == nil || rf.hr.Exceeded {
+		return rf.hr.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	}
+
+	return io.Copy(writerOnly{rf.hr}, src)
+}
+
+// writerOnly hides the io.ReaderFrom of a writer from io.Copy
+type writerOnly struct{ io.Writer }
+
+// recorderPusher pushes with the underlying writer
+type recorderPusher struct{ hr *HttpRecorder }
 
-	return len(str), nil
+func (p recorderPusher) Push(target string, opts *http.PushOptions) error {
+	return p.hr.ResponseWriter.(http.Pusher).Push(target, opts)
 }
@@ -1,9 +1,15 @@
 package cache_handler
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -24,3 +30,132 @@ func TestHttpRecorder(t *testing.T) {
 
 	assert.Equal(t, bodyBytes, hr.Body.Bytes())
 }
+
+func TestHttpRecorderStatus(t *testing.T) {
+	hr := NewHttpRecorder(httptest.NewRecorder())
+	hr.WriteString("content")
+	assert.Equal(t, http.StatusOK, hr.Status)
+
+	hr = NewHttpRecorder(httptest.NewRecorder())
+	hr.WriteHeader(http.StatusEarlyHints)
+	hr.WriteHeader(http.StatusNotFound)
+	hr.WriteHeader(http.StatusOK)
+	assert.Equal(t, http.StatusNotFound, hr.Status)
+}
+
+func TestHttpRecorderMaxSize(t *testing.T) {
+	w := httptest.NewRecorder()
+	hr := NewHttpRecorder(w)
+	hr.MaxSize = 8
+
+	hr.WriteString("1234")
+	hr.WriteString("5678")
+	assert.False(t, hr.Exceeded)
+	assert.Equal(t, "12345678", hr.Body.String())
+
+	hr.WriteString("9")
+	hr.WriteString("0")
+	assert.True(t, hr.Exceeded)
+	assert.Equal(t, 0, hr.Body.Len())
+	assert.Equal(t, "1234567890", w.Body.String())
+}
+
+// plainWriter is a http.ResponseWriter without optional interfaces
+type plainWriter struct{ http.ResponseWriter }
+
+// hijackWriter is a http.ResponseWriter that only supports hijacking
+type hijackWriter struct{ http.ResponseWriter }
+
+func (hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return nil, nil, nil }
+
+func TestHttpRecorderWriter(t *testing.T) {
+	hr := NewHttpRecorder(plainWriter{httptest.NewRecorder()})
+	w := hr.Writer()
+	assert.Same(t, hr, w)
+	_, ok := w.(http.Flusher)
+	assert.False(t, ok)
+
+	hr = NewHttpRecorder(hijackWriter{httptest.NewRecorder()})
+	w = hr.Writer()
+	_, ok = w.(http.Flusher)
+	assert.False(t, ok)
+	_, ok = w.(io.ReaderFrom)
+	assert.False(t, ok)
+	hijacker, ok := w.(http.Hijacker)
+	assert.True(t, ok)
+	_, _, err := hijacker.Hijack()
+	assert.NoError(t, err)
+	assert.True(t, hr.Hijacked)
+
+	rec := httptest.NewRecorder()
+	hr = NewHttpRecorder(rec)
+	w = hr.Writer()
+	_, ok = w.(http.Hijacker)
+	assert.False(t, ok)
+	w.Write([]byte("chunk"))
+	assert.NoError(t, http.NewResponseController(w).Flush())
+	assert.True(t, hr.Flushed)
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "chunk", hr.Body.String())
+}
+
+// unwrappingWriter only supports optional interfaces through Unwrap
+type unwrappingWriter struct{ http.ResponseWriter }
+
+func (w unwrappingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func TestHttpRecorderWriterUnwrapChain(t *testing.T) {
+	rec := httptest.NewRecorder()
+	hr := NewHttpRecorder(unwrappingWriter{rec})
+	w := hr.Writer()
+	_, ok := w.(http.Hijacker)
+	assert.False(t, ok)
+	w.Write([]byte("chunk"))
+	assert.NoError(t, http.NewResponseController(w).Flush())
+	assert.True(t, hr.Flushed)
+	assert.True(t, rec.Flushed)
+
+	hr = NewHttpRecorder(unwrappingWriter{unwrappingWriter{hijackWriter{rec}}})
+	w = hr.Writer()
+	_, ok = w.(http.Flusher)
+	assert.False(t, ok)
+	_, _, err := http.NewResponseController(w).Hijack()
+	assert.NoError(t, err)
+	assert.True(t, hr.Hijacked)
+}
+
+func TestHttpRecorderUnwrap(t *testing.T) {
+	rec := httptest.NewRecorder()
+	hr := NewHttpRecorder(plainWriter{rec})
+	assert.Equal(t, plainWriter{rec}, hr.Unwrap())
+
+	err := http.NewResponseController(hr.Writer()).SetWriteDeadline(time.Now())
+	assert.ErrorIs(t, err, http.ErrNotSupported)
+}
+
+func TestHttpRecorderReadFrom(t *testing.T) {
+	recorded := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hr := NewHttpRecorder(w)
+		hr.MaxSize = 8
+		rf, ok := hr.Writer().(io.ReaderFrom)
+		assert.True(t, ok)
+		rf.ReadFrom(strings.NewReader(r.URL.Query().Get("body")))
+		recorded = hr.Body.String()
+	}))
+	defer server.Close()
+
+	for _, body := range []string{"content", "too large content"} {
+		res, err := http.Get(server.URL + "?body=" + url.QueryEscape(body))
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, body, string(data))
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		if len(body) <= 8 {
+			assert.Equal(t, body, recorded)
+		} else {
+			assert.Empty(t, recorded)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package cache_handler
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/StevenCyb/cache_handler/store"
+)
+
+// route applies its own cache manager to requests that match its pattern
+type route struct {
+	pattern string
+	method  string
+	path    []string
+	opts    []Option
+	cm      *cacheManager
+}
+
+// parseRoute parses a pattern of the form `[METHOD ]PATH`.
+// The path is split into segments that are matched with path.Match,
+// a trailing `*` segment matches any number of remaining segments.
+func parseRoute(pattern string, opts []Option) (*route, error) {
+	rt := &route{pattern: pattern, opts: opts}
+
+	p := strings.TrimSpace(pattern)
+	if method, rest, found := strings.Cut(p, " "); found {
+		rt.method = strings.ToUpper(method)
+		p = strings.TrimSpace(rest)
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("route pattern %q must start with a '/'", pattern)
+	}
+
+	rt.path = strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for _, segment := range rt.path {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern %q: %w", pattern, err)
+		}
+	}
+
+	return rt, nil
+}
+
+// CheckRoutePattern returns an error if the pattern can't be used with WithRoute
+func CheckRoutePattern(pattern string) error {
+	_, err := parseRoute(pattern, nil)
+	return err
+}
+
+// matches returns if the route applies to given request,
+// HEAD requests match GET routes as they are answered from the GET response
+func (rt *route) matches(r *http.Request) bool {
+	if rt.method != "" && rt.method != r.Method &&
+		!(rt.method == http.MethodGet && r.Method == http.MethodHead) {
+		return false
+	}
+
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	for i, pattern := range rt.path {
+		if pattern == "*" && i == len(rt.path)-1 {
+			return len(segments) >= len(rt.path)
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if ok, _ := path.Match(pattern, segments[i]); !ok {
+			return false
+		}
+	}
+
+	return len(segments) == len(rt.path)
+}
+
+// WithRoute applies given options to requests that match the pattern.
+// The pattern has the form `[METHOD ]PATH` like `GET /users` or `/static/*`,
+// path segments can use the syntax of path.Match and a trailing `*`
+// matches everything below the path. Route options are applied on top of
+// the options of the middleware, the first matching route is used.
+// HEAD requests match GET routes.
+// It panics if the pattern is invalid.
+func WithRoute(pattern string, opts ...Option) Option {
+	rt, err := parseRoute(pattern, opts)
+	if err != nil {
+		panic("cache_handler: " + err.Error())
+	}
+
+	return optionFunc(func(cm *cacheManager) {
+		cm.routes = append(cm.routes, rt)
+	})
+}
+
+// WithStore sets the store used instead of the store of the middleware,
+// e.g. to use a different store for a route
+func WithStore(s store.Store) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.ownStore = s
+	})
+}
+
+// WithoutCache disables the cache, requests are passed to the next handler.
+// Used for routes that must never be cached.
+func WithoutCache() Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.Disabled = true
+	})
+}
+
+// useRoutes creates the cache managers of the routes,
+// must be called after the store is set
+func (cm *cacheManager) useRoutes() {
+	for i, rt := range cm.routes {
+		child := *cm
+		child.routes = nil
+		child.ownStore = nil
+		child.KeyParts = append([]KeyPart{}, cm.KeyParts...)
+		child.BypassRules = append([]BypassRule{}, cm.BypassRules...)
+		child.useOptions(rt.opts...)
+
+		if child.ownStore != nil || child.FailurePolicy != cm.FailurePolicy ||
+			child.breakerSettings != cm.breakerSettings {
+			s := child.ownStore
+			if s == nil {
+				s = cm.baseStore
+			}
+			child.useStore(s)
+		}
+
+		cm.routes[i] = &route{
+			pattern: rt.pattern,
+			method:  rt.method,
+			path:    rt.path,
+			opts:    rt.opts,
+			cm:      &child,
+		}
+	}
+}
+
+// route returns the cache manager of the first route that matches the request
+func (cm *cacheManager) route(r *http.Request) *cacheManager {
+	for _, rt := range cm.routes {
+		if rt.matches(r) {
+			return rt.cm
+		}
+	}
+
+	return cm
+}
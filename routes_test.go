@@ -0,0 +1,148 @@
+package cache_handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
+	"github.com/StevenCyb/cache_handler/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		method  string
+		path    string
+		matches bool
+	}{
+		{"/users", "GET", "/users", true},
+		{"/users", "POST", "/users", true},
+		{"/users", "GET", "/users/1", false},
+		{"/users", "GET", "/", false},
+		{"GET /users", "GET", "/users", true},
+		{"get /users", "GET", "/users", true},
+		{"GET /users", "POST", "/users", false},
+		{"GET /users", "HEAD", "/users", true},
+		{"HEAD /users", "HEAD", "/users", true},
+		{"HEAD /users", "GET", "/users", false},
+		{"POST /users", "HEAD", "/users", false},
+		{"/users/*", "GET", "/users/1", true},
+		{"/users/*", "GET", "/users/1/posts", true},
+		{"/users/*", "GET", "/users", false},
+		{"/users/*/posts", "GET", "/users/1/posts", true},
+		{"/users/*/posts", "GET", "/users/1/posts/2", false},
+		{"/static/*.css", "GET", "/static/main.css", true},
+		{"/static/*.css", "GET", "/static/main.js", false},
+		{"/", "GET", "/", true},
+		{"/", "GET", "/users", false},
+		{"/*", "GET", "/users/1", true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		rt, err := parseRoute(test.pattern, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, test.matches, rt.matches(r),
+			"%s matches %s %s", test.pattern, test.method, test.path)
+	}
+}
+
+func TestRouteInvalidPattern(t *testing.T) {
+	assert.Panics(t, func() { WithRoute("users") })
+	assert.Panics(t, func() { WithRoute("GET users") })
+	assert.Panics(t, func() { WithRoute("/users/[") })
+
+	assert.NoError(t, CheckRoutePattern("GET /users/*"))
+	assert.EqualError(t, CheckRoutePattern("users"), `route pattern "users" must start with a '/'`)
+	assert.ErrorContains(t, CheckRoutePattern("/users/["), "syntax error in pattern")
+}
+
+func TestMiddlewareRoutes(t *testing.T) {
+	calls := 0
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	defaultStore := store.NewInMemoryStore(time.Minute, store.WithClock(clock))
+	defer defaultStore.Close()
+	staticStore := store.NewInMemoryStore(time.Minute, store.WithClock(clock))
+	defer staticStore.Close()
+
+	testMiddlewareHandler := NewMiddleware(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Write([]byte(strconv.Itoa(calls)))
+		}, defaultStore,
+		WithClock(clock),
+		WithTTL(time.Minute),
+		WithRoute("GET /users", WithTTL(10*time.Minute), UseHeaderKey{Key: "Authorization"}),
+		WithRoute("/health", WithoutCache()),
+		WithRoute("/static/*", WithTTL(24*time.Hour), WithStore(staticStore)),
+	)
+
+	alice := http.Header{"Authorization": []string{"alice"}}
+	bob := http.Header{"Authorization": []string{"bob"}}
+	request(t, &testMiddlewareHandler, "GET", "/users", alice, 1)
+	request(t, &testMiddlewareHandler, "GET", "/users", alice, 1)
+	request(t, &testMiddlewareHandler, "GET", "/users", bob, 2)
+	request(t, &testMiddlewareHandler, "GET", "/health", http.Header{}, 3)
+	request(t, &testMiddlewareHandler, "GET", "/health", http.Header{}, 4)
+	request(t, &testMiddlewareHandler, "GET", "/static/app.js", http.Header{}, 5)
+	request(t, &testMiddlewareHandler, "GET", "/static/app.js", http.Header{}, 5)
+	request(t, &testMiddlewareHandler, "GET", "/other", http.Header{}, 6)
+	request(t, &testMiddlewareHandler, "GET", "/other", http.Header{}, 6)
+
+	key, err := newCacheManager(nil).keyFromRequest(httptest.NewRequest("GET", "/static/app.js", nil))
+	assert.NoError(t, err)
+	_, err = staticStore.Get(key)
+	assert.NoError(t, err)
+
+	clock.Advance(2 * time.Minute)
+	request(t, &testMiddlewareHandler, "GET", "/users", alice, 1)
+	request(t, &testMiddlewareHandler, "GET", "/static/app.js", http.Header{}, 5)
+	request(t, &testMiddlewareHandler, "GET", "/other", http.Header{}, 7)
+
+	clock.Advance(10 * time.Minute)
+	request(t, &testMiddlewareHandler, "GET", "/users", alice, 8)
+	request(t, &testMiddlewareHandler, "GET", "/static/app.js", http.Header{}, 5)
+}
+
+func TestMiddlewareRouteHead(t *testing.T) {
+	calls := 0
+	defaultStore := store.NewInMemoryStore(time.Hour)
+	defer defaultStore.Close()
+	usersStore := store.NewInMemoryStore(time.Hour)
+	defer usersStore.Close()
+	handler := NewMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(strconv.Itoa(calls)))
+	}, defaultStore,
+		WithRoute("GET /users", WithStore(usersStore), UseHeaderKey{Key: "Authorization"}),
+		WithCacheStatusHeader("", false))
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/users", nil)
+		r.Header.Set("Authorization", "alice")
+		handler(w, r)
+		return w
+	}
+
+	assert.Equal(t, "1", serve("GET").Body.String())
+	w := serve("HEAD")
+	assert.Equal(t, 1, calls, "HEAD is answered from the GET response of the route")
+	assert.Equal(t, "1", w.Header().Get("Content-Length"))
+	assert.Contains(t, w.Header().Get("Cache-Status"), "hit")
+}
+
+func TestRoutesDoNotShareOptions(t *testing.T) {
+	route := WithRoute("/users", UseHeaderKey{Key: "Authorization"})
+	a := newCacheManager(nil, route)
+	b := newCacheManager(nil, UseMethodKey{}, route)
+
+	assert.Equal(t, []KeyPart{UsePathKey{}}, a.KeyParts)
+	assert.Equal(t, []KeyPart{UsePathKey{}, UseHeaderKey{Key: "Authorization"}}, a.routes[0].cm.KeyParts)
+	assert.Equal(t, []KeyPart{UsePathKey{}, UseMethodKey{}, UseHeaderKey{Key: "Authorization"}}, b.routes[0].cm.KeyParts)
+}
@@ -0,0 +1,170 @@
+package cache_handler
+
+import (
+	"log/slog"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/clock"
+	"github.com/StevenCyb/cache_handler/metrics"
+)
+
+// optionFunc is an Option implemented by a function
+type optionFunc func(cm *cacheManager)
+
+func (fn optionFunc) apply(cm *cacheManager) { fn(cm) }
+
+// WithKeyPart adds a custom key part to the cache key,
+// key parts of this package are applied as options
+func WithKeyPart(part KeyPart) Option {
+	return optionFunc(func(cm *cacheManager) {
+		if opt, ok := part.(Option); ok {
+			opt.apply(cm)
+			return
+		}
+		cm.KeyParts = append(cm.KeyParts, part)
+	})
+}
+
+// WithBypassRule adds a custom rule that allows to bypass the cache
+func WithBypassRule(rule BypassRule) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.BypassRules = append(cm.BypassRules, rule)
+	})
+}
+
+// WithTTL sets how long responses are cached.
+// By default the expiration of the store is used.
+func WithTTL(ttl time.Duration) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.TTL = ttl
+	})
+}
+
+// WithMaxBodySize sets the maximum size of a response body that is cached,
+// larger responses are streamed to the client without buffering them and are
+// not recorded again for the uncacheable TTL. By default the size is not limited.
+func WithMaxBodySize(size int) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.MaxBodySize = size
+	})
+}
+
+// WithUncacheableTTL sets how long responses that exceeded the maximum body size
+// are forwarded without recording them again. By default the TTL of the cache is used.
+func WithUncacheableTTL(ttl time.Duration) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.UncacheableTTL = ttl
+	})
+}
+
+// WithCacheableStatus sets the status codes of responses that are cached.
+// By default the heuristically cacheable codes of RFC 9110 are cached:
+// 200, 203, 204, 300, 301, 308, 404, 405, 410, 414 and 501.
+// Partial responses (206) are never cached.
+func WithCacheableStatus(codes ...int) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.CacheableStatus = map[int]time.Duration{}
+		for _, code := range codes {
+			cm.CacheableStatus[code] = 0
+		}
+	})
+}
+
+// WithStatusTTL caches responses with the status code for ttl,
+// e.g. `WithStatusTTL(http.StatusNotFound, 30*time.Second)` for negative caching.
+// The code is added to the cacheable status codes, a ttl of 0 uses the TTL of the cache.
+func WithStatusTTL(code int, ttl time.Duration) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.CacheableStatus = maps.Clone(cm.CacheableStatus)
+		cm.CacheableStatus[code] = ttl
+	})
+}
+
+// WithoutCacheableStatus removes status codes from the cacheable status codes
+func WithoutCacheableStatus(codes ...int) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.CacheableStatus = maps.Clone(cm.CacheableStatus)
+		for _, code := range codes {
+			delete(cm.CacheableStatus, code)
+		}
+	})
+}
+
+// WithCacheableMethods sets the request methods whose responses are cached,
+// requests with other methods bypass the cache. By default GET and HEAD are cached.
+func WithCacheableMethods(methods ...string) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.CacheableMethod = map[string]bool{}
+		for _, method := range methods {
+			cm.CacheableMethod[strings.ToUpper(method)] = true
+		}
+	})
+}
+
+// WithLogger sets the logger the middleware reports store failures
+// and bypass decisions to. By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return optionFunc(func(cm *cacheManager) {
+		if logger != nil {
+			cm.Logger = logger
+		}
+	})
+}
+
+// WithMetrics sets the sink the middleware reports hits, misses, bypasses
+// and store failures to. By default metrics are discarded.
+func WithMetrics(sink metrics.Sink) Option {
+	return optionFunc(func(cm *cacheManager) {
+		if sink != nil {
+			cm.Metrics = sink
+		}
+	})
+}
+
+// WithClock sets the clock used for the creation time and age of cached responses.
+// By default the clock of the system is used.
+func WithClock(c clock.Clock) Option {
+	return optionFunc(func(cm *cacheManager) {
+		if c != nil {
+			cm.Clock = c
+		}
+	})
+}
+
+// WithCacheStatusHeader adds the `Cache-Status` header (RFC 9211) to responses.
+// name identifies the cache and defaults to `cache_handler`,
+// includeKey adds the cache key to the header.
+func WithCacheStatusHeader(name string, includeKey bool) Option {
+	return optionFunc(func(cm *cacheManager) {
+		if name == "" {
+			name = defaultCacheName
+		}
+		cm.CacheStatus = &cacheStatusHeader{name: name, includeKey: includeKey}
+	})
+}
+
+// WithAgeHeader adds the `Age` header to responses served from the cache
+func WithAgeHeader() Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.AgeHeader = true
+	})
+}
+
+// WithStoreFailurePolicy defines how to handle requests if the store fails
+// with an error other than a miss. The default policy is FailOpen.
+func WithStoreFailurePolicy(policy StoreFailurePolicy) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.FailurePolicy = policy
+	})
+}
+
+// WithCircuitBreaker uses the CircuitBreak policy that stops using the store
+// for coolDown (default 30s) after threshold (default 5) consecutive failures
+func WithCircuitBreaker(threshold int, coolDown time.Duration) Option {
+	return optionFunc(func(cm *cacheManager) {
+		cm.FailurePolicy = CircuitBreak
+		cm.breakerSettings = breakerSettings(threshold, coolDown)
+	})
+}
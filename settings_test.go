@@ -0,0 +1,46 @@
+package cache_handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings(t *testing.T) {
+	registry := metrics.NewRegistry()
+	cm := cacheManager{}
+	cm.useOptions(
+		WithKeyPart(UseHeaderKey{Key: "Authorization"}),
+		WithBypassRule(AllowBypassMethod{Key: "POST"}),
+		WithTTL(time.Hour),
+		WithMaxBodySize(1024),
+		WithCacheableStatus(http.StatusOK),
+		WithStatusTTL(http.StatusNotFound, time.Minute),
+		WithCacheableMethods("GET"),
+		WithMetrics(registry),
+		WithCacheStatusHeader("", true),
+		WithAgeHeader(),
+		WithCircuitBreaker(3, time.Minute),
+	)
+
+	assert.Equal(t, []KeyPart{UseHeaderKey{Key: "Authorization"}}, cm.KeyParts)
+	assert.Equal(t, []BypassRule{AllowBypassMethod{Key: "POST"}}, cm.BypassRules)
+	assert.Equal(t, time.Hour, cm.TTL)
+	assert.Equal(t, 1024, cm.MaxBodySize)
+	assert.Equal(t, map[int]time.Duration{http.StatusOK: 0, http.StatusNotFound: time.Minute}, cm.CacheableStatus)
+	assert.Equal(t, map[string]bool{"GET": true}, cm.CacheableMethod)
+	assert.Same(t, registry, cm.Metrics)
+	assert.Equal(t, &cacheStatusHeader{name: defaultCacheName, includeKey: true}, cm.CacheStatus)
+	assert.True(t, cm.AgeHeader)
+	assert.Equal(t, CircuitBreak, cm.FailurePolicy)
+	assert.Equal(t, breakerSettings(3, time.Minute), cm.breakerSettings)
+
+	cm.useOptions(WithStoreFailurePolicy(FailClosed), WithLogger(nil), WithMetrics(nil), WithClock(nil))
+	assert.Equal(t, FailClosed, cm.FailurePolicy)
+	assert.NotNil(t, cm.Logger)
+	assert.Same(t, registry, cm.Metrics)
+	assert.NotNil(t, cm.Clock)
+}
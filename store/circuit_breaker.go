@@ -0,0 +1,289 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// CircuitClosed passes all calls to the store
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all calls with ErrUnavailable
+	CircuitOpen
+	// CircuitHalfOpen passes a limited number of probe calls to the store
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// CircuitBreakerSettings configure a CircuitBreaker,
+// fields that are not set fall back to their default.
+type CircuitBreakerSettings struct {
+	// Window is the number of recent calls the failure rate is computed of (default 20)
+	Window int
+	// MinCalls is the number of calls required before the breaker can open (default 10)
+	MinCalls int
+	// FailureRate is the rate of failed calls within the window that opens the breaker (default 0.5)
+	FailureRate float64
+	// SlowCall is the latency from which on a call counts as failed (default none)
+	SlowCall time.Duration
+	// CoolDown is the time the breaker stays open before probing the store (default 30s)
+	CoolDown time.Duration
+	// Probes is the number of successful probe calls that close the breaker again (default 1)
+	Probes int
+}
+
+// withDefaults returns the settings with defaults for fields that are not set
+func (settings CircuitBreakerSettings) withDefaults() CircuitBreakerSettings {
+	if settings.Window <= 0 {
+		settings.Window = 20
+	}
+	if settings.MinCalls <= 0 {
+		settings.MinCalls = 10
+	}
+	if settings.MinCalls > settings.Window {
+		settings.MinCalls = settings.Window
+	}
+	if settings.FailureRate <= 0 || settings.FailureRate > 1 {
+		settings.FailureRate = 0.5
+	}
+	if settings.CoolDown <= 0 {
+		settings.CoolDown = 30 * time.Second
+	}
+	if settings.Probes <= 0 {
+		settings.Probes = 1
+	}
+
+	return settings
+}
+
+// CircuitBreaker wraps a store, tracks its failure rate and latency
+// and stops calling it for a cool-down period if it fails too often.
+// Afterwards probe calls decide if the store is used again.
+// Rejected calls return ErrUnavailable.
+//
+// Reported metrics:
+// `store.circuit_breaker.state` gauge (0 closed, 1 open, 2 half-open),
+// `store.circuit_breaker.calls`, `.failures` and `.rejected` counters and
+// `store.circuit_breaker.latency_seconds` summary.
+type CircuitBreaker struct {
+	store    Store
+	settings CircuitBreakerSettings
+	options  options
+
+	mutex          *sync.Mutex
+	state          CircuitState
+	results        []bool
+	next           int
+	calls          int
+	failures       int
+	openedAt       time.Time
+	probes         int
+	probeSuccesses int
+	// generation changes with each transition, so results of calls
+	// acquired in an earlier state are ignored
+	generation uint64
+}
+
+// NewCircuitBreaker create a new CircuitBreaker for given store
+func NewCircuitBreaker(store Store, settings CircuitBreakerSettings, opts ...Option) *CircuitBreaker {
+	settings = settings.withDefaults()
+	breaker := &CircuitBreaker{
+		store:    store,
+		settings: settings,
+		options:  newOptions(opts...),
+		mutex:    &sync.Mutex{},
+		results:  make([]bool, settings.Window),
+	}
+	breaker.options.metrics.Gauge("store.circuit_breaker.state", float64(CircuitClosed))
+
+	return breaker
+}
+
+// Get data from the wrapped store with given key
+func (breaker *CircuitBreaker) Get(key string) ([]byte, error) {
+	var data []byte
+	err := breaker.call(func() error {
+		var err error
+		data, err = breaker.store.Get(key)
+		return err
+	})
+
+	return data, err
+}
+
+// Set data to the wrapped store for given key
+func (breaker *CircuitBreaker) Set(key string, data []byte) error {
+	return breaker.call(func() error {
+		return breaker.store.Set(key, data)
+	})
+}
+
+// SetWithTTL set data to the wrapped store for given key that are valid for ttl
+func (breaker *CircuitBreaker) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	return breaker.call(func() error {
+		return breaker.store.SetWithTTL(key, data, ttl)
+	})
+}
+
+// Close closes the wrapped store
+func (breaker *CircuitBreaker) Close() error {
+	return breaker.store.Close()
+}
+
+// Expiration returns how long data are valid in the wrapped store
+func (breaker *CircuitBreaker) Expiration() time.Duration {
+	return breaker.store.Expiration()
+}
+
+// State returns the current state of the breaker
+func (breaker *CircuitBreaker) State() CircuitState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.refresh()
+	return breaker.state
+}
+
+// call the store with fn if the breaker allows it and track the result
+func (breaker *CircuitBreaker) call(fn func() error) error {
+	generation, ok := breaker.acquire()
+	if !ok {
+		breaker.options.metrics.Count("store.circuit_breaker.rejected", 1)
+		return ErrUnavailable
+	}
+
+	start := breaker.options.clock.Now()
+	err := fn()
+	latency := breaker.options.clock.Now().Sub(start)
+
+	breaker.options.metrics.Count("store.circuit_breaker.calls", 1)
+	breaker.options.metrics.Observe("store.circuit_breaker.latency_seconds", latency.Seconds())
+
+	failed := breaker.isFailure(err, latency)
+	if failed {
+		breaker.options.metrics.Count("store.circuit_breaker.failures", 1)
+	}
+	breaker.release(generation, failed)
+
+	return err
+}
+
+// isFailure returns if the call result counts as failure
+func (breaker *CircuitBreaker) isFailure(err error, latency time.Duration) bool {
+	if breaker.settings.SlowCall > 0 && latency > breaker.settings.SlowCall {
+		return true
+	}
+
+	return err != nil && !IsMiss(err) && !errors.Is(err, ErrTooLarge)
+}
+
+// acquire returns if a call is allowed and the generation it was allowed in
+func (breaker *CircuitBreaker) acquire() (uint64, bool) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.refresh()
+	switch breaker.state {
+	case CircuitOpen:
+		return breaker.generation, false
+	case CircuitHalfOpen:
+		if breaker.probes >= breaker.settings.Probes {
+			return breaker.generation, false
+		}
+		breaker.probes++
+	}
+
+	return breaker.generation, true
+}
+
+// release tracks the result of a call allowed in given generation,
+// results of calls allowed before the last transition are ignored
+func (breaker *CircuitBreaker) release(generation uint64, failed bool) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if generation != breaker.generation {
+		return
+	}
+
+	switch breaker.state {
+	case CircuitHalfOpen:
+		breaker.probes--
+		if failed {
+			breaker.transition(CircuitOpen)
+			return
+		}
+		breaker.probeSuccesses++
+		if breaker.probeSuccesses >= breaker.settings.Probes {
+			breaker.transition(CircuitClosed)
+		}
+	case CircuitClosed:
+		breaker.record(failed)
+		if breaker.calls >= breaker.settings.MinCalls &&
+			float64(breaker.failures)/float64(breaker.calls) >= breaker.settings.FailureRate {
+			breaker.transition(CircuitOpen)
+		}
+	}
+}
+
+// record the result of a call in the window
+func (breaker *CircuitBreaker) record(failed bool) {
+	if breaker.calls == len(breaker.results) {
+		if breaker.results[breaker.next] {
+			breaker.failures--
+		}
+	} else {
+		breaker.calls++
+	}
+
+	breaker.results[breaker.next] = failed
+	if failed {
+		breaker.failures++
+	}
+	breaker.next = (breaker.next + 1) % len(breaker.results)
+}
+
+// refresh switches from open to half-open after the cool-down
+func (breaker *CircuitBreaker) refresh() {
+	if breaker.state == CircuitOpen && breaker.options.clock.Now().Sub(breaker.openedAt) >= breaker.settings.CoolDown {
+		breaker.transition(CircuitHalfOpen)
+	}
+}
+
+// transition to given state and reset the tracking
+func (breaker *CircuitBreaker) transition(state CircuitState) {
+	breaker.state = state
+	breaker.generation++
+	breaker.calls, breaker.failures, breaker.next = 0, 0, 0
+	breaker.probes, breaker.probeSuccesses = 0, 0
+	if state == CircuitOpen {
+		breaker.openedAt = breaker.options.clock.Now()
+	}
+
+	breaker.options.metrics.Gauge("store.circuit_breaker.state", float64(state))
+	level := slog.LevelInfo
+	if state == CircuitOpen {
+		level = slog.LevelWarn
+	}
+	breaker.options.logger.Log(context.Background(), level, "circuit breaker state changed",
+		slog.String("store", "circuit_breaker"), slog.String("state", state.String()))
+}
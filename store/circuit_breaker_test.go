@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
+	"github.com/StevenCyb/cache_handler/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type flakyStore struct {
+	err   error
+	clock *clocktest.Fake
+	delay time.Duration
+	calls int
+}
+
+func (s *flakyStore) Get(key string) ([]byte, error) {
+	s.calls++
+	if s.clock != nil {
+		s.clock.Advance(s.delay)
+	}
+	return []byte(key), s.err
+}
+
+func (s *flakyStore) Set(key string, data []byte) error {
+	s.calls++
+	if s.clock != nil {
+		s.clock.Advance(s.delay)
+	}
+	return s.err
+}
+
+func (s *flakyStore) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	return s.Set(key, data)
+}
+
+func (s *flakyStore) Expiration() time.Duration { return time.Minute }
+
+func (s *flakyStore) Close() error { return nil }
+
+func TestCircuitBreakerSettingsDefaults(t *testing.T) {
+	assert.Equal(t, CircuitBreakerSettings{
+		Window: 20, MinCalls: 10, FailureRate: 0.5, CoolDown: 30 * time.Second, Probes: 1,
+	}, CircuitBreakerSettings{}.withDefaults())
+	assert.Equal(t, 5, CircuitBreakerSettings{Window: 5}.withDefaults().MinCalls)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	registry := metrics.NewRegistry()
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	flaky := &flakyStore{}
+	breaker := NewCircuitBreaker(flaky,
+		CircuitBreakerSettings{Window: 4, MinCalls: 4, FailureRate: 0.5, CoolDown: time.Minute},
+		WithMetrics(registry), WithClock(clock))
+	var _ Store = breaker
+
+	data, err := breaker.Get("dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("dummy"), data)
+
+	flaky.err = ErrNotFound
+	_, err = breaker.Get("dummy")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, CircuitClosed, breaker.State())
+
+	flaky.err = errors.New("connection refused")
+	assert.Error(t, breaker.Set("dummy", nil))
+	assert.Equal(t, CircuitClosed, breaker.State())
+	assert.Error(t, breaker.Set("dummy", nil))
+	assert.Equal(t, CircuitOpen, breaker.State())
+	assert.Equal(t, 1.0, registry.GaugeValue("store.circuit_breaker.state"))
+
+	_, err = breaker.Get("dummy")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, breaker.Set("dummy", nil), ErrUnavailable)
+	assert.Equal(t, 4, flaky.calls)
+	assert.Equal(t, int64(4), registry.Counter("store.circuit_breaker.calls"))
+	assert.Equal(t, int64(2), registry.Counter("store.circuit_breaker.failures"))
+	assert.Equal(t, int64(2), registry.Counter("store.circuit_breaker.rejected"))
+	assert.Equal(t, int64(4), registry.Summary("store.circuit_breaker.latency_seconds").Count)
+
+	clock.Advance(time.Minute - time.Second)
+	assert.Equal(t, CircuitOpen, breaker.State())
+	clock.Advance(time.Second)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	assert.Error(t, breaker.Set("dummy", nil))
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	clock.Advance(time.Minute)
+	flaky.err = nil
+	assert.NoError(t, breaker.Set("dummy", nil))
+	assert.Equal(t, CircuitClosed, breaker.State())
+	assert.Equal(t, 0.0, registry.GaugeValue("store.circuit_breaker.state"))
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	breaker := NewCircuitBreaker(&flakyStore{},
+		CircuitBreakerSettings{Probes: 2, CoolDown: time.Minute}, WithClock(clock))
+	breaker.transition(CircuitOpen)
+	clock.Advance(time.Minute)
+
+	generation, ok := breaker.acquire()
+	assert.True(t, ok)
+	_, ok = breaker.acquire()
+	assert.True(t, ok)
+	_, ok = breaker.acquire()
+	assert.False(t, ok)
+	breaker.release(generation, false)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	breaker.release(generation, false)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestCircuitBreakerIgnoresStaleResults(t *testing.T) {
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	breaker := NewCircuitBreaker(&flakyStore{},
+		CircuitBreakerSettings{Window: 2, MinCalls: 2, CoolDown: time.Minute}, WithClock(clock))
+
+	// a call acquired while closed finishes after the breaker opened and got half-open
+	closed, ok := breaker.acquire()
+	assert.True(t, ok)
+	breaker.transition(CircuitOpen)
+	clock.Advance(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+
+	breaker.release(closed, false)
+	assert.Equal(t, CircuitHalfOpen, breaker.State(), "a stale success is no probe")
+	assert.Equal(t, 0, breaker.probes)
+
+	probe, ok := breaker.acquire()
+	assert.True(t, ok)
+	breaker.release(closed, true)
+	assert.Equal(t, CircuitHalfOpen, breaker.State(), "a stale failure doesn't open the breaker")
+	breaker.release(probe, false)
+	assert.Equal(t, CircuitClosed, breaker.State())
+	assert.Equal(t, 0, breaker.probes)
+}
+
+func TestCircuitBreakerSlowCalls(t *testing.T) {
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	breaker := NewCircuitBreaker(&flakyStore{clock: clock, delay: 2 * time.Second},
+		CircuitBreakerSettings{Window: 2, MinCalls: 2, SlowCall: time.Second}, WithClock(clock))
+
+	_, err := breaker.Get("dummy")
+	assert.NoError(t, err)
+	_, err = breaker.Get("dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitOpen, breaker.State())
+}
+
+func TestCircuitStateString(t *testing.T) {
+	assert.Equal(t, "closed", CircuitClosed.String())
+	assert.Equal(t, "open", CircuitOpen.String())
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+	assert.Equal(t, "unknown", CircuitState(42).String())
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression of data stored by a CompressionStore
+type Codec byte
+
+const (
+	// CodecNone stores data uncompressed
+	CodecNone Codec = iota
+	// CodecGzip compresses with gzip
+	CodecGzip
+	// CodecSnappy compresses with snappy, fast with a lower ratio
+	CodecSnappy
+	// CodecZstd compresses with Zstandard
+	CodecZstd
+)
+
+// String returns the name of the codec
+func (codec Codec) String() string {
+	switch codec {
+	case CodecNone:
+		return "none"
+	case CodecGzip:
+		return "gzip"
+	case CodecSnappy:
+		return "snappy"
+	case CodecZstd:
+		return "zstd"
+	}
+
+	return "unknown"
+}
+
+// compressionMagic starts all data written by a CompressionStore,
+// it is followed by the codec byte
+var compressionMagic = []byte{0x00, 'c', 'h', 'z'}
+
+var (
+	// the default options are valid, so there are no errors
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// CompressionStore wraps a store and compresses data of at least threshold bytes with
+// the codec before storing them. Each value starts with a header that names its codec,
+// so data written with another codec or before the store was wrapped stay readable.
+// Data that don't get smaller are stored uncompressed.
+//
+// Reported metrics:
+// `store.compression.bytes_in` and `.bytes_out` counters of the uncompressed and stored size,
+// `store.compression.ratio` summary of the stored size divided by the uncompressed size.
+type CompressionStore struct {
+	store     Store
+	codec     Codec
+	threshold int
+	options   options
+}
+
+// NewCompressionStore create a new CompressionStore for given store
+func NewCompressionStore(store Store, codec Codec, threshold int, opts ...Option) *CompressionStore {
+	return &CompressionStore{
+		store:     store,
+		codec:     codec,
+		threshold: threshold,
+		options:   newOptions(opts...),
+	}
+}
+
+// Get data from the wrapped store with given key and decompress them.
+// Corrupt data are reported as ErrNotFound.
+func (store *CompressionStore) Get(key string) ([]byte, error) {
+	data, err := store.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, compressionMagic) || len(data) == len(compressionMagic) {
+		return data, nil
+	}
+
+	codec := Codec(data[len(compressionMagic)])
+	data, err = decompress(codec, data[len(compressionMagic)+1:])
+	if err != nil {
+		store.options.logger.Warn("failed to decompress cache entry",
+			slog.String("key", key), slog.String("codec", codec.String()), slog.Any("error", err))
+		return nil, fmt.Errorf("%w: key=%s corrupt %s data: %v", ErrNotFound, key, codec, err)
+	}
+
+	return data, nil
+}
+
+// Set compressed data to the wrapped store for given key
+func (store *CompressionStore) Set(key string, data []byte) error {
+	return store.store.Set(key, store.compress(data))
+}
+
+// SetWithTTL set compressed data to the wrapped store for given key that are valid for ttl
+func (store *CompressionStore) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	return store.store.SetWithTTL(key, store.compress(data), ttl)
+}
+
+// Close closes the wrapped store
+func (store *CompressionStore) Close() error {
+	return store.store.Close()
+}
+
+// Expiration returns how long data are valid in the wrapped store
+func (store *CompressionStore) Expiration() time.Duration {
+	return store.store.Expiration()
+}
+
+// compress data with the codec of the store and prefix them with the header
+func (store *CompressionStore) compress(data []byte) []byte {
+	codec, compressed := CodecNone, data
+	if len(data) >= store.threshold && store.codec != CodecNone {
+		var err error
+		compressed, err = compress(store.codec, data)
+		if err != nil || len(compressed) >= len(data) {
+			codec, compressed = CodecNone, data
+		} else {
+			codec = store.codec
+		}
+	}
+
+	stored := make([]byte, 0, len(compressionMagic)+1+len(compressed))
+	stored = append(stored, compressionMagic...)
+	stored = append(stored, byte(codec))
+	stored = append(stored, compressed...)
+
+	store.options.metrics.Count("store.compression.bytes_in", int64(len(data)))
+	store.options.metrics.Count("store.compression.bytes_out", int64(len(stored)))
+	if len(data) > 0 {
+		store.options.metrics.Observe("store.compression.ratio", float64(len(stored))/float64(len(data)))
+	}
+
+	return stored
+}
+
+// compress data with the codec
+func compress(codec Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case CodecGzip:
+		buf := &bytes.Buffer{}
+		writer := gzip.NewWriter(buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CodecSnappy:
+		return snappy.Encode(nil, data), nil
+	case CodecZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+
+	return nil, fmt.Errorf("unknown codec %d", codec)
+}
+
+// decompress data compressed with the codec
+func decompress(codec Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case CodecNone:
+		return data, nil
+	case CodecGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(reader)
+	case CodecSnappy:
+		return snappy.Decode(nil, data)
+	case CodecZstd:
+		return zstdDecoder.DecodeAll(data, nil)
+	}
+
+	return nil, fmt.Errorf("unknown codec %d", codec)
+}
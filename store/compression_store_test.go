@@ -0,0 +1,106 @@
+package store
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionStore(t *testing.T) {
+	content := []byte(strings.Repeat(`{"id":1,"name":"cache"},`, 64))
+
+	for _, codec := range []Codec{CodecNone, CodecGzip, CodecSnappy, CodecZstd} {
+		t.Run(codec.String(), func(t *testing.T) {
+			inner := NewInMemoryStore(time.Minute)
+			defer inner.Close()
+			s := NewCompressionStore(inner, codec, 64)
+			var _ Store = s
+
+			require.NoError(t, s.Set("large", content))
+			require.NoError(t, s.SetWithTTL("small", []byte("content"), time.Second))
+
+			data, err := s.Get("large")
+			assert.NoError(t, err)
+			assert.Equal(t, content, data)
+			data, err = s.Get("small")
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("content"), data)
+
+			stored, err := inner.Get("large")
+			require.NoError(t, err)
+			assert.Equal(t, byte(codec), stored[len(compressionMagic)])
+			if codec != CodecNone {
+				assert.Less(t, len(stored), len(content))
+			}
+			stored, err = inner.Get("small")
+			require.NoError(t, err)
+			assert.Equal(t, byte(CodecNone), stored[len(compressionMagic)], "small data are not compressed")
+		})
+	}
+}
+
+func TestCompressionStoreMixedData(t *testing.T) {
+	inner := NewInMemoryStore(time.Minute)
+	defer inner.Close()
+	content := []byte(strings.Repeat("content ", 64))
+
+	require.NoError(t, inner.Set("legacy", content))
+	require.NoError(t, NewCompressionStore(inner, CodecGzip, 0).Set("gzip", content))
+
+	s := NewCompressionStore(inner, CodecSnappy, 0)
+	for _, key := range []string{"legacy", "gzip"} {
+		data, err := s.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, content, data, key)
+	}
+}
+
+func TestCompressionStoreIncompressibleData(t *testing.T) {
+	inner := NewInMemoryStore(time.Minute)
+	defer inner.Close()
+	s := NewCompressionStore(inner, CodecGzip, 0)
+
+	require.NoError(t, s.Set("random", []byte{0x8f, 0x1a, 0x33, 0xe0}))
+	stored, err := inner.Get("random")
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, compressionMagic...), byte(CodecNone), 0x8f, 0x1a, 0x33, 0xe0), stored)
+}
+
+func TestCompressionStoreCorruptData(t *testing.T) {
+	logs := &bytes.Buffer{}
+	inner := NewInMemoryStore(time.Minute)
+	defer inner.Close()
+	s := NewCompressionStore(inner, CodecZstd, 0, WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+
+	require.NoError(t, inner.Set("dummy", append(append([]byte{}, compressionMagic...), byte(CodecZstd), 'x')))
+	_, err := s.Get("dummy")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Contains(t, logs.String(), `level=WARN msg="failed to decompress cache entry" key=dummy codec=zstd`)
+
+	_, err = s.Get("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCompressionStoreMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	inner := NewInMemoryStore(time.Minute)
+	defer inner.Close()
+	s := NewCompressionStore(inner, CodecGzip, 0, WithMetrics(registry))
+
+	content := []byte(strings.Repeat("a", 1000))
+	require.NoError(t, s.Set("dummy", content))
+	stored, err := inner.Get("dummy")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1000), registry.Counter("store.compression.bytes_in"))
+	assert.Equal(t, int64(len(stored)), registry.Counter("store.compression.bytes_out"))
+	summary := registry.Summary("store.compression.ratio")
+	assert.Equal(t, int64(1), summary.Count)
+	assert.InDelta(t, float64(len(stored))/1000, summary.Sum, 0.0001)
+}
@@ -0,0 +1,67 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/StevenCyb/cache_handler/store/storetest"
+	"github.com/alicebob/miniredis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, clock *clocktest.Fake, ttl time.Duration) store.Store {
+		s := store.NewInMemoryStore(ttl, store.WithClock(clock))
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestCompressionStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, clock *clocktest.Fake, ttl time.Duration) store.Store {
+		s := store.NewCompressionStore(store.NewInMemoryStore(ttl, store.WithClock(clock)), store.CodecZstd, 16)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestEncryptionStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, clock *clocktest.Fake, ttl time.Duration) store.Store {
+		keys := store.StaticKeys{Current: "1", Keys: map[string][]byte{"1": make([]byte, 32)}}
+		s := store.NewEncryptionStore(store.NewInMemoryStore(ttl, store.WithClock(clock)), keys)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestFilesystemStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, clock *clocktest.Fake, ttl time.Duration) store.Store {
+		s := store.NewFilesystem(t.TempDir(), ttl, store.WithClock(clock))
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestRedisStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, clock *clocktest.Fake, ttl time.Duration) store.Store {
+		mr, err := miniredis.Run()
+		require.NoError(t, err)
+		clock.OnAdvance(mr.FastForward)
+
+		s := store.NewRedisStore(mr.Addr(), 0, "", "", ttl)
+		t.Cleanup(func() { s.Close() })
+		t.Cleanup(mr.Close)
+		return s
+	})
+}
+
+func TestCircuitBreakerConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, clock *clocktest.Fake, ttl time.Duration) store.Store {
+		s := store.NewCircuitBreaker(store.NewInMemoryStore(ttl, store.WithClock(clock)),
+			store.CircuitBreakerSettings{})
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// KeyProvider provides the AES keys of an EncryptionStore.
+// Keys must be 16, 24 or 32 bytes long to use AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the id and key new data are encrypted with
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with given id to decrypt data,
+	// ErrUnknownKey if there is no such key
+	Key(id string) ([]byte, error)
+}
+
+// ErrUnknownKey is returned by a KeyProvider if it has no key with an id
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// StaticKeys is a KeyProvider with a fixed set of keys.
+// Data are encrypted with the key of Current, all keys can decrypt,
+// so a key can be rotated by adding a new key and making it current.
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// CurrentKey returns the id and key of Current
+func (keys StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := keys.Key(keys.Current)
+	return keys.Current, key, err
+}
+
+// Key returns the key with given id
+func (keys StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := keys.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+
+	return key, nil
+}
+
+// encryptionMagic starts all data written by an EncryptionStore,
+// it is followed by the length of the key id and the key id
+var encryptionMagic = []byte{0x00, 'c', 'h', 'e'}
+
+// EncryptionStore wraps a store and encrypts data with AES-GCM before storing them.
+// The ciphertext is bound to the cache key, so entries can't be swapped between keys.
+// Data are always encrypted with the current key of the KeyProvider and decrypted with
+// the key they were encrypted with, so keys can be rotated while old entries stay readable.
+// Data that are not encrypted or can't be decrypted are reported as ErrNotFound.
+//
+// Reported metrics:
+// `store.encryption.failures` counter of data that could not be decrypted.
+type EncryptionStore struct {
+	store   Store
+	keys    KeyProvider
+	options options
+}
+
+// NewEncryptionStore create a new EncryptionStore for given store
+func NewEncryptionStore(store Store, keys KeyProvider, opts ...Option) *EncryptionStore {
+	return &EncryptionStore{
+		store:   store,
+		keys:    keys,
+		options: newOptions(opts...),
+	}
+}
+
+// Get data from the wrapped store with given key and decrypt them
+func (store *EncryptionStore) Get(key string) ([]byte, error) {
+	data, err := store.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = store.decrypt(key, data)
+	if errors.Is(err, ErrNotFound) {
+		store.options.metrics.Count("store.encryption.failures", 1)
+		store.options.logger.Warn("failed to decrypt cache entry",
+			slog.String("key", key), slog.Any("error", err))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Set encrypted data to the wrapped store for given key
+func (store *EncryptionStore) Set(key string, data []byte) error {
+	encrypted, err := store.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+
+	return store.store.Set(key, encrypted)
+}
+
+// SetWithTTL set encrypted data to the wrapped store for given key that are valid for ttl
+func (store *EncryptionStore) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	encrypted, err := store.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+
+	return store.store.SetWithTTL(key, encrypted, ttl)
+}
+
+// Close closes the wrapped store
+func (store *EncryptionStore) Close() error {
+	return store.store.Close()
+}
+
+// Expiration returns how long data are valid in the wrapped store
+func (store *EncryptionStore) Expiration() time.Duration {
+	return store.store.Expiration()
+}
+
+// encrypt data with the current key, the header and cache key are authenticated
+func (store *EncryptionStore) encrypt(key string, data []byte) ([]byte, error) {
+	id, secret, err := store.keys.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key: %w", err)
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("encryption key id %q is longer than 255 bytes", id)
+	}
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key %q: %w", id, err)
+	}
+
+	header := make([]byte, 0, len(encryptionMagic)+1+len(id))
+	header = append(header, encryptionMagic...)
+	header = append(header, byte(len(id)))
+	header = append(header, id...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to create nonce: %w", err)
+	}
+
+	encrypted := append(header, nonce...)
+	return aead.Seal(encrypted, nonce, data, additionalData(header, key)), nil
+}
+
+// decrypt data with the key named in their header.
+// Data that are not encrypted or not authentic return ErrNotFound.
+func (store *EncryptionStore) decrypt(key string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptionMagic) || len(data) <= len(encryptionMagic) {
+		return nil, fmt.Errorf("%w: key=%s data are not encrypted", ErrNotFound, key)
+	}
+	idEnd := len(encryptionMagic) + 1 + int(data[len(encryptionMagic)])
+	if len(data) < idEnd {
+		return nil, fmt.Errorf("%w: key=%s truncated data", ErrNotFound, key)
+	}
+	header, id := data[:idEnd], string(data[len(encryptionMagic)+1:idEnd])
+
+	secret, err := store.keys.Key(id)
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, fmt.Errorf("%w: key=%s %w", ErrNotFound, key, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key %q: %w", id, err)
+	}
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key %q: %w", id, err)
+	}
+
+	if len(data) < idEnd+aead.NonceSize() {
+		return nil, fmt.Errorf("%w: key=%s truncated data", ErrNotFound, key)
+	}
+	nonce, ciphertext := data[idEnd:idEnd+aead.NonceSize()], data[idEnd+aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(header, key))
+	if err != nil {
+		return nil, fmt.Errorf("%w: key=%s data are not authentic", ErrNotFound, key)
+	}
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+
+	return plaintext, nil
+}
+
+// newAEAD creates AES-GCM for the key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds the ciphertext to its header and cache key
+func additionalData(header []byte, key string) []byte {
+	return append(append(bytes.Clone(header), 0x00), key...)
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys(current string) StaticKeys {
+	return StaticKeys{Current: current, Keys: map[string][]byte{
+		"2021-01": bytes.Repeat([]byte{1}, 32),
+		"2021-02": bytes.Repeat([]byte{2}, 16),
+	}}
+}
+
+func TestEncryptionStore(t *testing.T) {
+	inner := NewInMemoryStore(time.Minute)
+	defer inner.Close()
+	s := NewEncryptionStore(inner, testKeys("2021-01"))
+	var _ Store = s
+
+	require.NoError(t, s.Set("user:1", []byte("personal data")))
+	require.NoError(t, s.SetWithTTL("user:2", []byte("personal data"), time.Second))
+
+	data, err := s.Get("user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("personal data"), data)
+
+	stored, err := inner.Get("user:1")
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), "personal data")
+	assert.True(t, bytes.HasPrefix(stored, append(append([]byte{}, encryptionMagic...), 7, '2', '0', '2', '1', '-', '0', '1')))
+	other, err := inner.Get("user:2")
+	require.NoError(t, err)
+	assert.NotEqual(t, stored, other, "each value has its own nonce")
+
+	_, err = s.Get("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestEncryptionStoreKeyRotation(t *testing.T) {
+	inner := NewInMemoryStore(time.Minute)
+	defer inner.Close()
+	require.NoError(t, NewEncryptionStore(inner, testKeys("2021-01")).Set("old", []byte("old data")))
+
+	s := NewEncryptionStore(inner, testKeys("2021-02"))
+	data, err := s.Get("old")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("old data"), data)
+
+	require.NoError(t, s.Set("old", data))
+	stored, err := inner.Get("old")
+	require.NoError(t, err)
+	assert.Equal(t, "2021-02", string(stored[len(encryptionMagic)+1:len(encryptionMagic)+8]), "written with the current key")
+
+	retired := NewEncryptionStore(inner, StaticKeys{Current: "2021-03", Keys: map[string][]byte{"2021-03": make([]byte, 32)}})
+	_, err = retired.Get("old")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestEncryptionStoreBindsCacheKey(t *testing.T) {
+	logs := &bytes.Buffer{}
+	registry := metrics.NewRegistry()
+	inner := NewInMemoryStore(time.Minute)
+	defer inner.Close()
+	s := NewEncryptionStore(inner, testKeys("2021-01"),
+		WithLogger(slog.New(slog.NewTextHandler(logs, nil))), WithMetrics(registry))
+
+	require.NoError(t, s.Set("user:1", []byte("data of user 1")))
+	stored, err := inner.Get("user:1")
+	require.NoError(t, err)
+	require.NoError(t, inner.Set("user:2", stored))
+
+	_, err = s.Get("user:2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Contains(t, logs.String(), `level=WARN msg="failed to decrypt cache entry" key=user:2`)
+	assert.Equal(t, int64(1), registry.Counter("store.encryption.failures"))
+
+	tampered := bytes.Clone(stored)
+	tampered[len(tampered)-1] ^= 1
+	require.NoError(t, inner.Set("user:1", tampered))
+	_, err = s.Get("user:1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for _, data := range [][]byte{[]byte("plaintext"), encryptionMagic, append(bytes.Clone(encryptionMagic), 200)} {
+		require.NoError(t, inner.Set("invalid", data))
+		_, err = s.Get("invalid")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+}
+
+type failingKeys struct{}
+
+func (failingKeys) CurrentKey() (string, []byte, error) {
+	return "", nil, errors.New("kms unavailable")
+}
+func (failingKeys) Key(id string) ([]byte, error) { return nil, errors.New("kms unavailable") }
+
+func TestEncryptionStoreKeyErrors(t *testing.T) {
+	inner := NewInMemoryStore(time.Minute)
+	defer inner.Close()
+
+	s := NewEncryptionStore(inner, failingKeys{})
+	assert.EqualError(t, s.Set("dummy", []byte("data")), "failed to get encryption key: kms unavailable")
+
+	require.NoError(t, NewEncryptionStore(inner, testKeys("2021-01")).Set("dummy", []byte("data")))
+	_, err := s.Get("dummy")
+	assert.EqualError(t, err, `failed to get encryption key "2021-01": kms unavailable`)
+	assert.False(t, IsMiss(err))
+
+	invalid := NewEncryptionStore(inner, StaticKeys{Current: "short", Keys: map[string][]byte{"short": []byte("key")}})
+	assert.ErrorContains(t, invalid.Set("dummy", []byte("data")), `invalid encryption key "short"`)
+}
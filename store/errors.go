@@ -0,0 +1,23 @@
+package store
+
+import "errors"
+
+var (
+	// ErrNotFound is returned if the store has no data for a key
+	ErrNotFound = errors.New("no data for key")
+	// ErrExpired is returned if the data for a key are expired
+	ErrExpired = errors.New("data for key expired")
+	// ErrClosed is returned if the store was closed
+	ErrClosed = errors.New("store is closed")
+	// ErrTooLarge is returned if data exceed the maximum entry size of the store
+	ErrTooLarge = errors.New("data exceed maximum entry size")
+	// ErrUnavailable is returned if the store is not used temporarily,
+	// e.g. by an open CircuitBreaker
+	ErrUnavailable = errors.New("store is unavailable")
+)
+
+// IsMiss reports whether the error just means that there are no valid data
+// for a key, in contrast to a failure of the store
+func IsMiss(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired)
+}
@@ -0,0 +1,18 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsMiss(t *testing.T) {
+	assert.True(t, IsMiss(ErrNotFound))
+	assert.True(t, IsMiss(fmt.Errorf("%w: key=abc", ErrExpired)))
+	assert.False(t, IsMiss(ErrClosed))
+	assert.False(t, IsMiss(ErrTooLarge))
+	assert.False(t, IsMiss(errors.New("connection refused")))
+	assert.False(t, IsMiss(nil))
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"sync"
 	"time"
@@ -11,6 +12,7 @@ import (
 // FilesystemData represens data in file on filesystem
 type FilesystemData struct {
 	creationTime time.Time
+	ttl          time.Duration
 	path         string
 }
 
@@ -20,25 +22,33 @@ type FilesystemStore struct {
 	fileIndex  map[string]FilesystemData
 	expiration time.Duration
 	mutex      *sync.RWMutex
+	options    options
+	closed     chan struct{}
 }
 
 // NewFilesystem create a new FilesystemStore
-func NewFilesystem(basePath string, expiration time.Duration) *FilesystemStore {
+func NewFilesystem(basePath string, expiration time.Duration, opts ...Option) *FilesystemStore {
 	store := &FilesystemStore{
 		basePath:   basePath,
 		fileIndex:  map[string]FilesystemData{},
 		expiration: expiration,
 		mutex:      &sync.RWMutex{},
+		options:    newOptions(opts...),
+		closed:     make(chan struct{}),
 	}
 
 	go func() {
 		for {
-			time.Sleep(store.expiration)
+			select {
+			case <-store.closed:
+				return
+			case <-store.options.clock.After(store.expiration):
+			}
 
 			keysToDelete := map[string]FilesystemData{}
 			store.mutex.RLock()
 			for key, fileIndex := range store.fileIndex {
-				if time.Since(fileIndex.creationTime) > store.expiration {
+				if store.options.clock.Now().Sub(fileIndex.creationTime) > fileIndex.ttl {
 					keysToDelete[key] = fileIndex
 				}
 			}
@@ -49,8 +59,17 @@ func NewFilesystem(basePath string, expiration time.Duration) *FilesystemStore {
 				delete(store.fileIndex, key)
 			}
 			store.mutex.Unlock()
-			for _, value := range keysToDelete {
-				os.Remove(value.path)
+			for key, value := range keysToDelete {
+				if err := os.Remove(value.path); err != nil && !os.IsNotExist(err) {
+					store.options.logger.Warn("failed to remove expired cache file",
+						slog.String("store", "filesystem"), slog.String("key", key),
+						slog.String("path", value.path), slog.Any("error", err))
+				}
+			}
+
+			if len(keysToDelete) > 0 {
+				store.options.logger.Debug("evicted expired entries",
+					slog.String("store", "filesystem"), slog.Int("count", len(keysToDelete)))
 			}
 		}
 	}()
@@ -59,26 +78,57 @@ func NewFilesystem(basePath string, expiration time.Duration) *FilesystemStore {
 }
 
 // Get data from store with given key
-func (store FilesystemStore) Get(key string) ([]byte, error) {
+func (store *FilesystemStore) Get(key string) ([]byte, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	if data, ok := store.fileIndex[key]; ok && time.Since(data.creationTime) <= store.expiration {
-		content, err := ioutil.ReadFile(data.path)
-		if err != nil {
-			return nil, err
+	if store.fileIndex == nil {
+		return nil, ErrClosed
+	}
+
+	data, ok := store.fileIndex[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: key=%s", ErrNotFound, key)
+	}
+	if store.options.clock.Now().Sub(data.creationTime) > data.ttl {
+		return nil, fmt.Errorf("%w: key=%s", ErrExpired, key)
+	}
+
+	content, err := ioutil.ReadFile(data.path)
+	if err != nil {
+		store.options.logger.Warn("failed to read indexed cache file",
+			slog.String("store", "filesystem"), slog.String("key", key),
+			slog.String("path", data.path), slog.Any("error", err))
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: key=%s: %v", ErrNotFound, key, err)
 		}
-		return content, nil
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("no data for key=%s", key)
+	return content, nil
 }
 
 // Put data to store fore given key
 func (store *FilesystemStore) Set(key string, data []byte) error {
+	return store.SetWithTTL(key, data, store.expiration)
+}
+
+// SetWithTTL put data to store fore given key that are valid for ttl
+func (store *FilesystemStore) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = store.expiration
+	}
+	if err := store.options.checkSize(key, data); err != nil {
+		return err
+	}
+
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
+	if store.fileIndex == nil {
+		return ErrClosed
+	}
+
 	path := store.basePath + "/" + key
 	err := ioutil.WriteFile(path, data, 0644)
 	if err != nil {
@@ -86,9 +136,37 @@ func (store *FilesystemStore) Set(key string, data []byte) error {
 	}
 
 	store.fileIndex[key] = FilesystemData{
-		creationTime: time.Now(),
+		creationTime: store.options.clock.Now(),
+		ttl:          ttl,
 		path:         path,
 	}
 
 	return nil
 }
+
+// Close stops the cleanup and removes all files of the store
+func (store *FilesystemStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.fileIndex == nil {
+		return ErrClosed
+	}
+
+	close(store.closed)
+	for key, value := range store.fileIndex {
+		if err := os.Remove(value.path); err != nil && !os.IsNotExist(err) {
+			store.options.logger.Warn("failed to remove cache file",
+				slog.String("store", "filesystem"), slog.String("key", key),
+				slog.String("path", value.path), slog.Any("error", err))
+		}
+	}
+	store.fileIndex = nil
+
+	return nil
+}
+
+// Expiration returns how long data are valid
+func (store *FilesystemStore) Expiration() time.Duration {
+	return store.expiration
+}
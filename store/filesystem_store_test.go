@@ -1,16 +1,21 @@
 package store
 
 import (
+	"bytes"
 	"errors"
+	"log/slog"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestFilesystemStore(t *testing.T) {
-	store := NewFilesystem("./", 1*time.Second)
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	store := NewFilesystem("./", 1*time.Second, WithClock(clock))
+	defer store.Close()
 	err := store.Set("dummy1", []byte("content1"))
 	assert.NoError(t, err)
 	err = store.Set("dummy2", []byte("content2"))
@@ -28,13 +33,15 @@ func TestFilesystemStore(t *testing.T) {
 		filesToCheck = append(filesToCheck, fileIndex.path)
 	}
 
-	time.Sleep(1 * time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Second)
 	_, err = store.Get("dummy1")
 	assert.Error(t, err)
 	_, err = store.Get("dummy2")
 	assert.Error(t, err)
 
-	time.Sleep(1 * time.Second)
+	// wait until the cleanup finished and waits for the next run
+	clock.BlockUntil(1)
 	assert.Equal(t, 0, len(store.fileIndex))
 	for _, fileToCheck := range filesToCheck {
 		_, err := os.Stat(fileToCheck)
@@ -42,3 +49,47 @@ func TestFilesystemStore(t *testing.T) {
 			"FileSystemStoreGC failed to delete %s", fileToCheck)
 	}
 }
+
+func TestFilesystemStoreLogsCorruptEntry(t *testing.T) {
+	logs := &bytes.Buffer{}
+	store := NewFilesystem(t.TempDir(), time.Minute,
+		WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+
+	err := store.Set("dummy", []byte("content"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(store.fileIndex["dummy"].path))
+
+	_, err = store.Get("dummy")
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), "level=WARN msg=\"failed to read indexed cache file\"")
+	assert.Contains(t, logs.String(), "key=dummy")
+}
+
+func TestFilesystemStoreErrors(t *testing.T) {
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	store := NewFilesystem(t.TempDir(), time.Minute, WithMaxEntrySize(4), WithClock(clock))
+
+	_, err := store.Get("dummy")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, store.Set("dummy", []byte("content")), ErrTooLarge)
+	// set the data after the start of the cleanup interval
+	// so they expire before the cleanup removes them
+	clock.Advance(10 * time.Second)
+	assert.NoError(t, store.Set("dummy", []byte("data")))
+	path := store.fileIndex["dummy"].path
+
+	clock.BlockUntil(1)
+	clock.Advance(50 * time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(15 * time.Second)
+	_, err = store.Get("dummy")
+	assert.ErrorIs(t, err, ErrExpired)
+
+	assert.NoError(t, store.Close())
+	_, err = os.Stat(path)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.ErrorIs(t, store.Close(), ErrClosed)
+	_, err = store.Get("dummy")
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, store.Set("dummy", []byte("data")), ErrClosed)
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -9,6 +10,7 @@ import (
 // InMemoryData represens data in memory store
 type InMemoryData struct {
 	creationTime time.Time
+	ttl          time.Duration
 	data         []byte
 }
 
@@ -17,24 +19,32 @@ type InMemoryStore struct {
 	data       map[string]InMemoryData
 	expiration time.Duration
 	mutex      *sync.RWMutex
+	options    options
+	closed     chan struct{}
 }
 
 // NewInMemoryStore create a new InMemoryStore
-func NewInMemoryStore(expiration time.Duration) *InMemoryStore {
+func NewInMemoryStore(expiration time.Duration, opts ...Option) *InMemoryStore {
 	store := &InMemoryStore{
 		data:       map[string]InMemoryData{},
 		expiration: expiration,
 		mutex:      &sync.RWMutex{},
+		options:    newOptions(opts...),
+		closed:     make(chan struct{}),
 	}
 
 	go func() {
 		for {
-			time.Sleep(store.expiration)
+			select {
+			case <-store.closed:
+				return
+			case <-store.options.clock.After(store.expiration):
+			}
 
 			keysToDelete := []string{}
 			store.mutex.RLock()
 			for key, data := range store.data {
-				if time.Since(data.creationTime) > store.expiration {
+				if store.options.clock.Now().Sub(data.creationTime) > data.ttl {
 					keysToDelete = append(keysToDelete, key)
 				}
 			}
@@ -45,6 +55,11 @@ func NewInMemoryStore(expiration time.Duration) *InMemoryStore {
 				delete(store.data, key)
 			}
 			store.mutex.Unlock()
+
+			if len(keysToDelete) > 0 {
+				store.options.logger.Debug("evicted expired entries",
+					slog.String("store", "in_memory"), slog.Int("count", len(keysToDelete)))
+			}
 		}
 	}()
 
@@ -52,26 +67,71 @@ func NewInMemoryStore(expiration time.Duration) *InMemoryStore {
 }
 
 // Get data from store with given key
-func (store InMemoryStore) Get(key string) ([]byte, error) {
+func (store *InMemoryStore) Get(key string) ([]byte, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	if data, ok := store.data[key]; ok && time.Since(data.creationTime) <= store.expiration {
-		return data.data, nil
+	if store.data == nil {
+		return nil, ErrClosed
+	}
+
+	data, ok := store.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: key=%s", ErrNotFound, key)
+	}
+	if store.options.clock.Now().Sub(data.creationTime) > data.ttl {
+		return nil, fmt.Errorf("%w: key=%s", ErrExpired, key)
 	}
 
-	return nil, fmt.Errorf("no data for key=%s", key)
+	return data.data, nil
 }
 
 // Put data to store fore given key
 func (store *InMemoryStore) Set(key string, data []byte) error {
+	return store.SetWithTTL(key, data, store.expiration)
+}
+
+// SetWithTTL put data to store fore given key that are valid for ttl
+func (store *InMemoryStore) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = store.expiration
+	}
+	if err := store.options.checkSize(key, data); err != nil {
+		return err
+	}
+
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
+	if store.data == nil {
+		return ErrClosed
+	}
+
 	store.data[key] = InMemoryData{
-		creationTime: time.Now(),
+		creationTime: store.options.clock.Now(),
+		ttl:          ttl,
 		data:         data,
 	}
 
 	return nil
 }
+
+// Close stops the cleanup and drops all data
+func (store *InMemoryStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.data == nil {
+		return ErrClosed
+	}
+
+	close(store.closed)
+	store.data = nil
+
+	return nil
+}
+
+// Expiration returns how long data are valid
+func (store *InMemoryStore) Expiration() time.Duration {
+	return store.expiration
+}
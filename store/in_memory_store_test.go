@@ -4,11 +4,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestInMemoryStore(t *testing.T) {
-	store := NewInMemoryStore(1 * time.Second)
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	store := NewInMemoryStore(1*time.Second, WithClock(clock))
+	defer store.Close()
 	err := store.Set("dummy1", []byte("content1"))
 	assert.NoError(t, err)
 	err = store.Set("dummy2", []byte("content2"))
@@ -21,12 +24,40 @@ func TestInMemoryStore(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, data, []byte("content2"))
 
-	time.Sleep(1 * time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Second)
 	_, err = store.Get("dummy1")
 	assert.Error(t, err)
 	_, err = store.Get("dummy2")
 	assert.Error(t, err)
 
-	time.Sleep(1 * time.Second)
+	// wait until the cleanup finished and waits for the next run
+	clock.BlockUntil(1)
 	assert.Equal(t, 0, len(store.data))
 }
+
+func TestInMemoryStoreErrors(t *testing.T) {
+	clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+	store := NewInMemoryStore(time.Minute, WithMaxEntrySize(4), WithClock(clock))
+
+	_, err := store.Get("dummy")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, store.Set("dummy", []byte("content")), ErrTooLarge)
+	// set the data after the start of the cleanup interval
+	// so they expire before the cleanup removes them
+	clock.Advance(10 * time.Second)
+	assert.NoError(t, store.Set("dummy", []byte("data")))
+
+	clock.BlockUntil(1)
+	clock.Advance(50 * time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(15 * time.Second)
+	_, err = store.Get("dummy")
+	assert.ErrorIs(t, err, ErrExpired)
+
+	assert.NoError(t, store.Close())
+	assert.ErrorIs(t, store.Close(), ErrClosed)
+	_, err = store.Get("dummy")
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, store.Set("dummy", []byte("data")), ErrClosed)
+}
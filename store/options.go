@@ -0,0 +1,82 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/StevenCyb/cache_handler/clock"
+	"github.com/StevenCyb/cache_handler/metrics"
+)
+
+// Option configures optional behavior of a store
+type Option func(*options)
+
+// options collects the optional configuration of a store
+type options struct {
+	logger       *slog.Logger
+	metrics      metrics.Sink
+	clock        clock.Clock
+	maxEntrySize int
+}
+
+// WithLogger sets the logger used to report evictions and corrupt entries.
+// By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithMetrics sets the sink store metrics are reported to.
+// By default metrics are discarded.
+func WithMetrics(sink metrics.Sink) Option {
+	return func(o *options) {
+		if sink != nil {
+			o.metrics = sink
+		}
+	}
+}
+
+// WithClock sets the clock used to expire data and to schedule the cleanup.
+// By default the clock of the system is used.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		if c != nil {
+			o.clock = c
+		}
+	}
+}
+
+// WithMaxEntrySize limits the size of data that can be set for a key.
+// Set returns ErrTooLarge for larger data. By default the size is not limited.
+func WithMaxEntrySize(size int) Option {
+	return func(o *options) {
+		o.maxEntrySize = size
+	}
+}
+
+// checkSize returns ErrTooLarge if data exceed the maximum entry size
+func (o options) checkSize(key string, data []byte) error {
+	if o.maxEntrySize > 0 && len(data) > o.maxEntrySize {
+		return fmt.Errorf("%w: key=%s size=%d max=%d", ErrTooLarge, key, len(data), o.maxEntrySize)
+	}
+
+	return nil
+}
+
+// newOptions applies given options on top of the defaults
+func newOptions(opts ...Option) options {
+	o := options{
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		metrics: metrics.Discard,
+		clock:   clock.Real,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
@@ -2,21 +2,33 @@ package store
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// redisMaxEntrySize is the maximum size of a string value in Redis
+const redisMaxEntrySize = 512 * 1024 * 1024
+
 // RedisStore uses Redis
 type RedisStore struct {
 	Client     *redis.Client
 	expiration time.Duration
+	options    options
 }
 
 // NewRedisStore creates a new RedisStore.
 // Use empty string for username & password if not password required.
 // Set port to 0 to use default.
-func NewRedisStore(endpoint string, port int, username, password string, expiration time.Duration) *RedisStore {
+func NewRedisStore(endpoint string, port int, username, password string, expiration time.Duration, opts ...Option) *RedisStore {
+	o := newOptions(opts...)
+	if o.maxEntrySize <= 0 || o.maxEntrySize > redisMaxEntrySize {
+		o.maxEntrySize = redisMaxEntrySize
+	}
+
 	return &RedisStore{
 		Client: redis.NewClient(&redis.Options{
 			Addr:     endpoint,
@@ -25,17 +37,64 @@ func NewRedisStore(endpoint string, port int, username, password string, expirat
 			DB:       port,
 		}),
 		expiration: expiration,
+		options:    o,
 	}
 }
 
 // Get data from store with given key
 func (store RedisStore) Get(key string) ([]byte, error) {
-	return store.Client.Get(context.TODO(), key).Bytes()
+	data, err := store.Client.Get(context.TODO(), key).Bytes()
+	if err != nil {
+		err = store.convertError(key, err)
+		if !IsMiss(err) {
+			store.options.logger.Warn("failed to get entry from redis",
+				slog.String("store", "redis"), slog.String("key", key), slog.Any("error", err))
+		}
+		return nil, err
+	}
+
+	return data, nil
 }
 
 // Put data to store fore given key
 func (store RedisStore) Set(key string, data []byte) error {
-	statusCmd := store.Client.Set(context.TODO(), key, data, store.expiration)
+	return store.SetWithTTL(key, data, store.expiration)
+}
+
+// SetWithTTL put data to store fore given key that are valid for ttl
+func (store RedisStore) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = store.expiration
+	}
+	if err := store.options.checkSize(key, data); err != nil {
+		return err
+	}
+
+	statusCmd := store.Client.Set(context.TODO(), key, data, ttl)
 	_, err := statusCmd.Result()
+	return store.convertError(key, err)
+}
+
+// Close closes the client, data remain in Redis until they expire
+func (store RedisStore) Close() error {
+	return store.convertError("", store.Client.Close())
+}
+
+// Expiration returns how long data are valid
+func (store RedisStore) Expiration() time.Duration {
+	return store.expiration
+}
+
+// convertError maps Redis client errors to the errors of this package
+func (store RedisStore) convertError(key string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, redis.Nil):
+		return fmt.Errorf("%w: key=%s", ErrNotFound, key)
+	case errors.Is(err, redis.ErrClosed):
+		return ErrClosed
+	}
+
 	return err
 }
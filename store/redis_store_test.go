@@ -1,7 +1,6 @@
 package store
 
 import (
-	"strconv"
 	"testing"
 	"time"
 
@@ -9,26 +8,21 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestRedisStore(t *testing.T) {
+func TestRedisStoreErrors(t *testing.T) {
 	mr, err := miniredis.Run()
 	assert.NoError(t, err)
+	defer mr.Close()
 
-	port, err := strconv.Atoi(mr.Port())
-	assert.NoError(t, err)
-	redisStore := NewRedisStore(mr.Addr(), port, "", "", 1*time.Second)
-
-	err = redisStore.Set("dummy1", []byte("content1"))
-	assert.NoError(t, err)
-	err = redisStore.Set("dummy2", []byte("content2"))
-	assert.NoError(t, err)
+	redisStore := NewRedisStore(mr.Addr(), 0, "", "", time.Minute, WithMaxEntrySize(4))
 
-	data, err := redisStore.Get("dummy1")
-	assert.NoError(t, err)
-	assert.Equal(t, data, []byte("content1"))
-	data, err = redisStore.Get("dummy2")
-	assert.NoError(t, err)
-	assert.Equal(t, data, []byte("content2"))
+	_, err = redisStore.Get("dummy")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, redisStore.Set("dummy", []byte("content")), ErrTooLarge)
+	assert.NoError(t, redisStore.Set("dummy", []byte("data")))
 
-	// BUG cant test expired keys, miniredis seems to ignore
-	// key expiration
+	assert.NoError(t, redisStore.Close())
+	assert.ErrorIs(t, redisStore.Close(), ErrClosed)
+	_, err = redisStore.Get("dummy")
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, redisStore.Set("dummy", []byte("data")), ErrClosed)
 }
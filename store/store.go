@@ -1,7 +1,19 @@
 package store
 
-// Store represents a store
+import "time"
+
+// Store represents a store.
+// Get returns ErrNotFound or ErrExpired if there are no valid data for a key,
+// Set and SetWithTTL return ErrTooLarge if data exceed the maximum entry size.
+// All return ErrClosed after the store was closed.
 type Store interface {
 	Get(key string) ([]byte, error)
+	// Set data for a key that are valid for the expiration of the store
 	Set(key string, data []byte) error
+	// SetWithTTL set data for a key that are valid for given ttl,
+	// a ttl <= 0 uses the expiration of the store
+	SetWithTTL(key string, data []byte, ttl time.Duration) error
+	// Expiration returns how long data are valid by default
+	Expiration() time.Duration
+	Close() error
 }
@@ -2,6 +2,7 @@ package store
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -9,10 +10,19 @@ import (
 func TestStoreInterface(t *testing.T) {
 	var filesystemStore Store = NewFilesystem("", 0)
 	assert.NotNil(t, filesystemStore)
+	defer filesystemStore.Close()
 
 	var inMemoryStore Store = NewInMemoryStore(0)
 	assert.NotNil(t, inMemoryStore)
+	defer inMemoryStore.Close()
 
 	var redisStore Store = NewRedisStore("", 0, "", "", 0)
 	assert.NotNil(t, redisStore)
+	defer redisStore.Close()
+}
+
+func TestStoreExpiration(t *testing.T) {
+	assert.Equal(t, time.Minute, NewFilesystem("", time.Minute).Expiration())
+	assert.Equal(t, time.Minute, NewInMemoryStore(time.Minute).Expiration())
+	assert.Equal(t, time.Minute, NewRedisStore("", 0, "", "", time.Minute).Expiration())
 }
@@ -0,0 +1,194 @@
+// Package storetest provides a conformance test suite for store.Store implementations.
+package storetest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/clock/clocktest"
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TTL is the expiration the stores under test are created with
+const TTL = time.Minute
+
+// Factory creates a new empty store for a test.
+// Data of the store must expire after ttl measured by given clock,
+// stores that expire data externally can follow the clock with clock.OnAdvance.
+type Factory func(t *testing.T, clock *clocktest.Fake, ttl time.Duration) store.Store
+
+// Run runs the conformance test suite against stores created by factory
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.Store, clock *clocktest.Fake)
+	}{
+		{"GetMissing", testGetMissing},
+		{"SetGet", testSetGet},
+		{"Overwrite", testOverwrite},
+		{"Expiry", testExpiry},
+		{"SetWithTTL", testSetWithTTL},
+		{"Concurrency", testConcurrency},
+		{"LargeValue", testLargeValue},
+		{"BinaryData", testBinaryData},
+		{"EmptyValue", testEmptyValue},
+		{"Close", testClose},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			clock := clocktest.NewFake(time.Date(2021, 11, 20, 10, 0, 0, 0, time.UTC))
+			s := factory(t, clock, TTL)
+			require.NotNil(t, s)
+			test.test(t, s, clock)
+		})
+	}
+}
+
+func testGetMissing(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	_, err := s.Get("missing")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.True(t, store.IsMiss(err))
+}
+
+func testSetGet(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	require.NoError(t, s.Set("dummy1", []byte("content1")))
+	require.NoError(t, s.Set("dummy2", []byte("content2")))
+
+	data, err := s.Get("dummy1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("content1"), data)
+	data, err = s.Get("dummy2")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("content2"), data)
+}
+
+func testOverwrite(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	require.NoError(t, s.Set("dummy", []byte("content1")))
+	require.NoError(t, s.Set("dummy", []byte("content2")))
+
+	data, err := s.Get("dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("content2"), data)
+}
+
+func testExpiry(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	require.NoError(t, s.Set("dummy1", []byte("content1")))
+	clock.Advance(TTL / 2)
+	require.NoError(t, s.Set("dummy2", []byte("content2")))
+
+	clock.Advance(TTL/2 - time.Second)
+	_, err := s.Get("dummy1")
+	assert.NoError(t, err, "data expired before ttl")
+
+	clock.Advance(2 * time.Second)
+	_, err = s.Get("dummy1")
+	assert.True(t, store.IsMiss(err), "data not expired after ttl: %v", err)
+	_, err = s.Get("dummy2")
+	assert.NoError(t, err, "data expired before ttl")
+
+	clock.Advance(TTL)
+	_, err = s.Get("dummy2")
+	assert.True(t, store.IsMiss(err), "data not expired after ttl: %v", err)
+
+	require.NoError(t, s.Set("dummy1", []byte("content3")))
+	data, err := s.Get("dummy1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("content3"), data)
+}
+
+func testSetWithTTL(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	assert.Equal(t, TTL, s.Expiration())
+	require.NoError(t, s.SetWithTTL("short", []byte("content1"), TTL/2))
+	require.NoError(t, s.SetWithTTL("long", []byte("content2"), 2*TTL))
+	require.NoError(t, s.SetWithTTL("default", []byte("content3"), 0))
+
+	clock.Advance(TTL/2 + time.Second)
+	_, err := s.Get("short")
+	assert.True(t, store.IsMiss(err), "data not expired after ttl: %v", err)
+	_, err = s.Get("default")
+	assert.NoError(t, err, "data expired before ttl")
+
+	clock.Advance(TTL / 2)
+	_, err = s.Get("default")
+	assert.True(t, store.IsMiss(err), "data not expired after ttl: %v", err)
+	data, err := s.Get("long")
+	assert.NoError(t, err, "data expired before ttl")
+	assert.Equal(t, []byte("content2"), data)
+
+	clock.Advance(TTL)
+	_, err = s.Get("long")
+	assert.True(t, store.IsMiss(err), "data not expired after ttl: %v", err)
+}
+
+func testConcurrency(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			own := fmt.Sprintf("own%d", i)
+			for j := 0; j < 50; j++ {
+				content := []byte(fmt.Sprintf("content%d-%d", i, j))
+				assert.NoError(t, s.Set(own, content))
+				data, err := s.Get(own)
+				assert.NoError(t, err)
+				assert.Equal(t, content, data)
+
+				assert.NoError(t, s.Set("shared", content))
+				if _, err := s.Get("shared"); err != nil {
+					assert.True(t, store.IsMiss(err), "unexpected error: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := s.Get("shared")
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("content")))
+}
+
+func testLargeValue(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+	require.NoError(t, s.Set("large", content))
+
+	data, err := s.Get("large")
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+}
+
+func testBinaryData(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	content := make([]byte, 512)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	require.NoError(t, s.Set("binary", content))
+
+	data, err := s.Get("binary")
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+}
+
+func testEmptyValue(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	require.NoError(t, s.Set("empty", []byte{}))
+
+	data, err := s.Get("empty")
+	assert.NoError(t, err)
+	assert.Len(t, data, 0)
+}
+
+func testClose(t *testing.T, s store.Store, clock *clocktest.Fake) {
+	require.NoError(t, s.Set("dummy", []byte("content")))
+	require.NoError(t, s.Close())
+
+	_, err := s.Get("dummy")
+	assert.ErrorIs(t, err, store.ErrClosed)
+	assert.ErrorIs(t, s.Set("dummy", []byte("content")), store.ErrClosed)
+}
@@ -0,0 +1,44 @@
+package cache_handler
+
+import (
+	"time"
+
+	"github.com/StevenCyb/cache_handler/store"
+)
+
+// StoreFailurePolicy defines how the middleware reacts to a failing store
+type StoreFailurePolicy int
+
+const (
+	// FailOpen serves the request from the handler without storing the response
+	FailOpen StoreFailurePolicy = iota
+	// FailClosed responds with `503 Service Unavailable`
+	FailClosed
+	// CircuitBreak behaves like FailOpen but wraps the store in a
+	// store.CircuitBreaker that stops using the store for a cool-down period
+	// after consecutive failures, see WithCircuitBreaker
+	CircuitBreak
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCoolDown  = 30 * time.Second
+)
+
+// breakerSettings returns circuit breaker settings that open after
+// threshold consecutive failures
+func breakerSettings(threshold int, coolDown time.Duration) store.CircuitBreakerSettings {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if coolDown <= 0 {
+		coolDown = defaultBreakerCoolDown
+	}
+
+	return store.CircuitBreakerSettings{
+		Window:      threshold,
+		MinCalls:    threshold,
+		FailureRate: 1,
+		CoolDown:    coolDown,
+	}
+}
@@ -0,0 +1,19 @@
+package cache_handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/StevenCyb/cache_handler/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerSettings(t *testing.T) {
+	assert.Equal(t, store.CircuitBreakerSettings{
+		Window: defaultBreakerThreshold, MinCalls: defaultBreakerThreshold,
+		FailureRate: 1, CoolDown: defaultBreakerCoolDown,
+	}, breakerSettings(0, 0))
+	assert.Equal(t, store.CircuitBreakerSettings{
+		Window: 2, MinCalls: 2, FailureRate: 1, CoolDown: time.Minute,
+	}, breakerSettings(2, time.Minute))
+}